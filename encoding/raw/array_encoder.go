@@ -26,6 +26,7 @@ type arrayEncoder struct {
 	worker      Encoder
 	workerStore reflect.Value
 	store       reflect.Value
+	reuse       bool
 }
 
 func (e arrayEncoder) Signature() string {
@@ -42,7 +43,7 @@ func (e arrayEncoder) WriteTo(w io.Writer) (int64, error) {
 		n, err := e.worker.WriteTo(w)
 		nc += n
 		if err != nil {
-			return nc, err
+			return nc, prependPath(err, "["+strconv.Itoa(i)+"]")
 		}
 	}
 	return nc, nil
@@ -54,10 +55,13 @@ func (e arrayEncoder) ReadFrom(r io.Reader) (int64, error) {
 	storeLen := storeVal.Len()
 	workerVal := e.workerStore.Elem()
 	for i := 0; i < storeLen; i++ {
+		if e.reuse {
+			workerVal.Set(storeVal.Index(i))
+		}
 		n, err := e.worker.ReadFrom(r)
 		nc += n
 		if err != nil {
-			return nc, err
+			return nc, decodeError(err, "["+strconv.Itoa(i)+"]", nc-n, e.worker.Signature())
 		}
 		storeVal.Index(i).Set(workerVal)
 	}
@@ -0,0 +1,59 @@
+// Copyright 2016 Rafael Lorandi <coolparadox@gmail.com>
+// This file is part of Raw, a binary encoder of Go types.
+//
+// Raw is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Raw is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Raw. If not, see <http://www.gnu.org/licenses/>.
+
+package raw
+
+import (
+	"io"
+	"math/big"
+)
+
+// bigFloatEncoder serializes big.Float values
+// as the byte sequence answered by their GobEncode method,
+// which preserves precision, rounding mode and accuracy
+// (see Time and Big Numbers).
+type bigFloatEncoder struct {
+	store  *big.Float
+	layout *[]byte
+	worker Encoder
+}
+
+func (bigFloatEncoder) Signature() string {
+	return "big.Float"
+}
+
+func (e bigFloatEncoder) WriteTo(w io.Writer) (int64, error) {
+	b, err := e.store.GobEncode()
+	if err != nil {
+		return 0, err
+	}
+	*e.layout = b
+	return e.worker.WriteTo(w)
+}
+
+func (e bigFloatEncoder) ReadFrom(r io.Reader) (int64, error) {
+	n, err := e.worker.ReadFrom(r)
+	if err != nil {
+		return n, layoutError(err, e.Signature())
+	}
+	x := new(big.Float)
+	err = x.GobDecode(*e.layout)
+	if err != nil {
+		return n, err
+	}
+	*e.store = *x
+	return n, nil
+}
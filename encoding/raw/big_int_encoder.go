@@ -0,0 +1,60 @@
+// Copyright 2016 Rafael Lorandi <coolparadox@gmail.com>
+// This file is part of Raw, a binary encoder of Go types.
+//
+// Raw is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Raw is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Raw. If not, see <http://www.gnu.org/licenses/>.
+
+package raw
+
+import (
+	"io"
+	"math/big"
+)
+
+// bigIntEncoder serializes big.Int values
+// as a bigIntLayout (see Time and Big Numbers).
+type bigIntEncoder struct {
+	store  *big.Int
+	layout *bigIntLayout
+	worker Encoder
+}
+
+// bigIntLayout is the serialized form of big.Int values:
+// the sign (-1, 0 or +1) and the big endian bytes of the absolute value.
+type bigIntLayout struct {
+	Sign int8
+	Abs  []byte
+}
+
+func (bigIntEncoder) Signature() string {
+	return "big.Int"
+}
+
+func (e bigIntEncoder) WriteTo(w io.Writer) (int64, error) {
+	e.layout.Sign = int8(e.store.Sign())
+	e.layout.Abs = e.store.Bytes()
+	return e.worker.WriteTo(w)
+}
+
+func (e bigIntEncoder) ReadFrom(r io.Reader) (int64, error) {
+	n, err := e.worker.ReadFrom(r)
+	if err != nil {
+		return n, layoutError(err, e.Signature())
+	}
+	x := new(big.Int).SetBytes(e.layout.Abs)
+	if e.layout.Sign < 0 {
+		x.Neg(x)
+	}
+	*e.store = *x
+	return n, nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2016 Rafael Lorandi <coolparadox@gmail.com>
+// This file is part of Raw, a binary encoder of Go types.
+//
+// Raw is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Raw is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Raw. If not, see <http://www.gnu.org/licenses/>.
+
+package raw
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// bigRatEncoder serializes big.Rat values
+// as a bigRatLayout (see Time and Big Numbers).
+type bigRatEncoder struct {
+	store  *big.Rat
+	layout *bigRatLayout
+	worker Encoder
+}
+
+// bigRatLayout is the serialized form of big.Rat values:
+// the sign (-1, 0 or +1) and the big endian bytes of
+// the absolute values of the numerator and the denominator.
+type bigRatLayout struct {
+	Sign  int8
+	Num   []byte
+	Denom []byte
+}
+
+func (bigRatEncoder) Signature() string {
+	return "big.Rat"
+}
+
+func (e bigRatEncoder) WriteTo(w io.Writer) (int64, error) {
+	e.layout.Sign = int8(e.store.Sign())
+	e.layout.Num = e.store.Num().Bytes()
+	e.layout.Denom = e.store.Denom().Bytes()
+	return e.worker.WriteTo(w)
+}
+
+func (e bigRatEncoder) ReadFrom(r io.Reader) (int64, error) {
+	n, err := e.worker.ReadFrom(r)
+	if err != nil {
+		return n, layoutError(err, e.Signature())
+	}
+	num := new(big.Int).SetBytes(e.layout.Num)
+	denom := new(big.Int).SetBytes(e.layout.Denom)
+	if denom.Sign() == 0 {
+		return n, fmt.Errorf("big.Rat with zero denominator")
+	}
+	if e.layout.Sign < 0 {
+		num.Neg(num)
+	}
+	*e.store = *new(big.Rat).SetFrac(num, denom)
+	return n, nil
+}
@@ -0,0 +1,104 @@
+// Copyright 2016 Rafael Lorandi <coolparadox@gmail.com>
+// This file is part of Raw, a binary encoder of Go types.
+//
+// Raw is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Raw is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Raw. If not, see <http://www.gnu.org/licenses/>.
+
+package raw
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+)
+
+/*
+Codec serializes and recovers values of type T,
+in the same format as Encoders of T
+created with the same Options.
+
+Unlike Encoders, a Codec is not bound to a placeholder variable
+and is safe for concurrent use:
+each call takes an Encoder of its own from a free list,
+where a few Encoders are kept for later calls.
+*/
+type Codec[T any] struct {
+	options   Options
+	signature string
+	plans     planList
+}
+
+// NewCodec creates a Codec of T
+// in the format of Encoders created by New.
+func NewCodec[T any]() (*Codec[T], error) {
+	return NewCodecWithOptions[T](Options{})
+}
+
+// NewCodecWithOptions creates a Codec of T
+// in the format of Encoders created by NewWithOptions.
+// Option Reuse is not supported,
+// since decoded values are not retained by the Codec.
+func NewCodecWithOptions[T any](o Options) (*Codec[T], error) {
+	if o.Reuse {
+		return nil, fmt.Errorf("codecs cannot reuse allocations")
+	}
+	p, err := newPlan(reflect.TypeOf((*T)(nil)).Elem(), o)
+	if err != nil {
+		return nil, err
+	}
+	c := &Codec[T]{options: o, signature: p.encoder.Signature()}
+	c.plans.put(p)
+	return c, nil
+}
+
+// Signature answers the type signature of T (see Signature).
+func (c *Codec[T]) Signature() string {
+	return c.signature
+}
+
+// get answers a plan of T, to be returned by put after use.
+func (c *Codec[T]) get() *plan {
+	if p := c.plans.get(); p != nil {
+		return p
+	}
+	// Creation already succeeded for the same type in NewCodecWithOptions.
+	p, _ := newPlan(reflect.TypeOf((*T)(nil)).Elem(), c.options)
+	return p
+}
+
+// put makes a plan available for reuse.
+func (c *Codec[T]) put(p *plan) {
+	p.clear()
+	c.plans.put(p)
+}
+
+// Encode serializes a value to w.
+func (c *Codec[T]) Encode(w io.Writer, v T) error {
+	p := c.get()
+	defer c.put(p)
+	*p.placeholder.Interface().(*T) = v
+	_, err := p.encoder.WriteTo(w)
+	return err
+}
+
+// Decode recovers a value from r.
+func (c *Codec[T]) Decode(r io.Reader) (T, error) {
+	p := c.get()
+	defer c.put(p)
+	_, err := p.encoder.ReadFrom(r)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return *p.placeholder.Interface().(*T), nil
+}
@@ -0,0 +1,186 @@
+// Copyright 2016 Rafael Lorandi <coolparadox@gmail.com>
+// This file is part of Raw, a binary encoder of Go types.
+//
+// Raw is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Raw is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Raw. If not, see <http://www.gnu.org/licenses/>.
+
+package raw
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// BadHeaderError is returned by ReadFrom and Write
+// of self-describing Encoders
+// when data does not start with a valid type header.
+var BadHeaderError = errors.New("bad type header")
+
+// SignatureMismatchError is returned by ReadFrom and Write
+// of self-describing Encoders
+// when the type header of data does not match the Encoder's signature.
+var SignatureMismatchError = errors.New("type signature mismatch")
+
+// TrailingDataError is returned by Write
+// when bytes are found past the end of the sequence.
+var TrailingDataError = errors.New("data past the end of the sequence")
+
+// UnregisteredTypeError is returned when serializing or recovering
+// an interface value whose concrete type is not registered
+// (see Register).
+var UnregisteredTypeError = errors.New("type not registered")
+
+// NonCanonicalError is returned by Encoders with canonical maps
+// when a map cannot be serialized in canonical form,
+// or when recovering a map not in canonical form
+// (see Canonical Maps).
+var NonCanonicalError = errors.New("map not in canonical form")
+
+// LengthOverflowError is returned by WriteTo and Read
+// when the length of a slice, map, string or byte sequence
+// exceeds the greatest length of the serialization format
+// (see Variable-Length Lengths).
+var LengthOverflowError = errors.New("length exceeds format limit")
+
+// CorruptRecordError is returned by Next of StreamReader
+// when a record of the stream fails its checksums
+// (see Record Streams).
+var CorruptRecordError = errors.New("corrupt record")
+
+// LimitError is returned by ReadFrom and Write
+// when serialized data exceeds a decoding limit (see Limits).
+type LimitError struct {
+
+	// Limit is the name of the exceeded field of Limits.
+	Limit string
+
+	// Max is the value of the exceeded limit.
+	Max int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("decoding limit %s of %v exceeded", e.Limit, e.Max)
+}
+
+/*
+DecodeError is returned by ReadFrom and Write
+when recovery of serialized data fails,
+telling where the failure happened.
+Function errors.Is and errors.As reach the cause of the failure
+through Unwrap.
+*/
+type DecodeError struct {
+
+	// Offset is the position in serialized data
+	// where the failing value starts,
+	// in bytes from the start of the recovery.
+	Offset int64
+
+	// Path is the location of the failing value
+	// within the placeholder variable,
+	// eg. `.Orders[12].Lines["sku"].Qty`,
+	// or empty for the placeholder variable itself.
+	Path string
+
+	// Signature is the type signature of the failing value
+	// (see Signature).
+	Signature string
+
+	// Err is the cause of the failure.
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	msg := fmt.Sprintf("cannot recover %s at offset %v: %s", e.Signature, e.Offset, e.Err)
+	if e.Path == "" {
+		return msg
+	}
+	return e.Path + ": " + msg
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// decodeError annotates an error of recovery of an inner value
+// with an outer step of its location,
+// and the offset of the inner value within the outer one.
+// Parameter signature is the signature of the inner value,
+// recorded only if the error is not annotated yet.
+func decodeError(err error, step string, offset int64, signature string) error {
+	if de, ok := err.(*DecodeError); ok {
+		return &DecodeError{Offset: offset + de.Offset, Path: step + de.Path, Signature: de.Signature, Err: de.Err}
+	}
+	return &DecodeError{Offset: offset, Path: step, Signature: signature, Err: err}
+}
+
+// truncated converts a premature end of data
+// into io.ErrUnexpectedEOF,
+// given the number of bytes already consumed
+// from the enclosing sequence.
+// Inner values report io.EOF when they find no data at all,
+// which is an error only if part of the sequence was read.
+func truncated(err error, consumed int64) error {
+	if consumed == 0 {
+		return err
+	}
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	if de, ok := err.(*DecodeError); ok && de.Err == io.EOF {
+		return &DecodeError{Offset: de.Offset, Path: de.Path, Signature: de.Signature, Err: io.ErrUnexpectedEOF}
+	}
+	return err
+}
+
+// layoutError converts an error of recovery
+// of the serialized form of a value with built-in support
+// (see Time and Big Numbers)
+// to an error of the value itself,
+// hiding locations within the serialized form.
+func layoutError(err error, signature string) error {
+	if de, ok := err.(*DecodeError); ok {
+		return &DecodeError{Offset: de.Offset, Signature: signature, Err: de.Err}
+	}
+	return err
+}
+
+// pathError is an error annotated with
+// the location within the placeholder variable where it happened,
+// eg. ".Events[3]".
+type pathError struct {
+	path string
+	err  error
+}
+
+func (e *pathError) Error() string {
+	if e.path == "" {
+		return e.err.Error()
+	}
+	return e.path + ": " + e.err.Error()
+}
+
+func (e *pathError) Unwrap() error {
+	return e.err
+}
+
+// prependPath annotates an error with an outer step of its location.
+// Errors not annotated by a pathError are answered unchanged,
+// so only errors originated by interface values carry a location.
+func prependPath(err error, step string) error {
+	if pe, ok := err.(*pathError); ok {
+		return &pathError{path: step + pe.path, err: pe.err}
+	}
+	return err
+}
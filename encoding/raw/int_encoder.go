@@ -0,0 +1,49 @@
+// Copyright 2016 Rafael Lorandi <coolparadox@gmail.com>
+// This file is part of Raw, a binary encoder of Go types.
+//
+// Raw is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Raw is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Raw. If not, see <http://www.gnu.org/licenses/>.
+
+package raw
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+// intEncoder serializes int values as 64 bit integers,
+// whatever the platform size of int.
+type intEncoder struct{ store *int }
+
+func (intEncoder) Signature() string {
+	return "int"
+}
+
+func (e intEncoder) WriteTo(w io.Writer) (int64, error) {
+	aux := int64(*e.store)
+	return int64Encoder{&aux}.WriteTo(w)
+}
+
+func (e intEncoder) ReadFrom(r io.Reader) (int64, error) {
+	var aux int64
+	n, err := int64Encoder{&aux}.ReadFrom(r)
+	if err != nil {
+		return n, err
+	}
+	if aux < math.MinInt || aux > math.MaxInt {
+		return n, fmt.Errorf("value %v overflows int", aux)
+	}
+	*e.store = int(aux)
+	return n, nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2016 Rafael Lorandi <coolparadox@gmail.com>
+// This file is part of Raw, a binary encoder of Go types.
+//
+// Raw is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Raw is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Raw. If not, see <http://www.gnu.org/licenses/>.
+
+package raw
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// interfaceEncoder serializes interface values
+// as the registered name of the concrete type (see Register)
+// followed by the serialized concrete value.
+// A nil interface value is serialized as an empty name.
+type interfaceEncoder struct {
+	store   reflect.Value
+	builder *builder
+	workers map[reflect.Type]interfaceWorker
+}
+
+// interfaceWorker is an Encoder of a concrete type
+// together with its placeholder.
+type interfaceWorker struct {
+	worker      Encoder
+	workerStore reflect.Value
+}
+
+func (interfaceEncoder) Signature() string {
+	return "interface"
+}
+
+// worker answers an Encoder for a concrete type,
+// creating it on first use.
+func (e interfaceEncoder) worker(t reflect.Type) (interfaceWorker, error) {
+	if w, ok := e.workers[t]; ok {
+		return w, nil
+	}
+	ws := reflect.New(t)
+	w, err := e.builder.fresh().makeEncoder(ws)
+	if err != nil {
+		return interfaceWorker{}, fmt.Errorf("cannot make encoder for type %s: %s", t, err)
+	}
+	e.workers[t] = interfaceWorker{worker: w, workerStore: ws}
+	return e.workers[t], nil
+}
+
+func (e interfaceEncoder) WriteTo(w io.Writer) (int64, error) {
+	var nc int64
+	storeVal := e.store.Elem()
+	var name string
+	if storeVal.IsNil() {
+		return stringEncoder{store: &name, varint: e.builder.options.VarintLengths}.WriteTo(w)
+	}
+	t := storeVal.Elem().Type()
+	name, ok := registeredName(t)
+	if !ok {
+		return nc, &pathError{err: fmt.Errorf("%w: %s", UnregisteredTypeError, t)}
+	}
+	iw, err := e.worker(t)
+	if err != nil {
+		return nc, err
+	}
+	n, err := stringEncoder{store: &name, varint: e.builder.options.VarintLengths}.WriteTo(w)
+	nc += n
+	if err != nil {
+		return nc, err
+	}
+	iw.workerStore.Elem().Set(storeVal.Elem())
+	n, err = iw.worker.WriteTo(w)
+	nc += n
+	return nc, err
+}
+
+func (e interfaceEncoder) ReadFrom(r io.Reader) (int64, error) {
+	var nc int64
+	var name string
+	n, err := stringEncoder{store: &name, max: e.builder.options.Limits.MaxStringLength, varint: e.builder.options.VarintLengths}.ReadFrom(r)
+	nc += n
+	if err != nil {
+		return nc, err
+	}
+	storeVal := e.store.Elem()
+	if name == "" {
+		storeVal.Set(reflect.Zero(storeVal.Type()))
+		return nc, nil
+	}
+	t, ok := registeredType(name)
+	if !ok {
+		return nc, fmt.Errorf("%w: '%s'", UnregisteredTypeError, name)
+	}
+	if !t.Implements(storeVal.Type()) {
+		return nc, fmt.Errorf("type %s registered as '%s' does not implement %s", t, name, storeVal.Type())
+	}
+	iw, err := e.worker(t)
+	if err != nil {
+		return nc, err
+	}
+	// The placeholder still holds the previous value decoded by this worker,
+	// whose allocations must not be reused by the new one.
+	iw.workerStore.Elem().Set(reflect.Zero(t))
+	n, err = iw.worker.ReadFrom(r)
+	nc += n
+	if err != nil {
+		return nc, decodeError(err, "", nc-n, iw.worker.Signature())
+	}
+	storeVal.Set(iw.workerStore.Elem())
+	return nc, nil
+}
@@ -0,0 +1,758 @@
+// Copyright 2016 Rafael Lorandi <coolparadox@gmail.com>
+// This file is part of Raw, a binary encoder of Go types.
+//
+// Raw is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Raw is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Raw. If not, see <http://www.gnu.org/licenses/>.
+
+package raw
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+/*
+ToJSON converts serialized data of a given type signature to JSON
+(see JSON Transcoding).
+
+Data must be in the format of Encoders created by New,
+without a type header,
+and must hold a single value.
+*/
+func ToJSON(signature string, data []byte) ([]byte, error) {
+	r := bytes.NewReader(data)
+	v, err := ReadValue(signature, r)
+	if err != nil {
+		return nil, err
+	}
+	if r.Len() > 0 {
+		return nil, fmt.Errorf("%v bytes left after value", r.Len())
+	}
+	return v.MarshalJSON()
+}
+
+/*
+FromJSON converts JSON to serialized data of a given type signature
+(see JSON Transcoding).
+
+Answers data in the format of Encoders created by New,
+without a type header.
+*/
+func FromJSON(signature string, data []byte) ([]byte, error) {
+	s, err := ParseSignature(signature)
+	if err != nil {
+		return nil, err
+	}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var x interface{}
+	err = d.Decode(&x)
+	if err != nil {
+		return nil, err
+	}
+	if d.More() {
+		return nil, fmt.Errorf("unexpected data after JSON value")
+	}
+	v, err := valueFromJSON(x, s, nil)
+	if err != nil {
+		return nil, err
+	}
+	b := new(bytes.Buffer)
+	err = v.write(b)
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// MarshalJSON converts v to JSON (see JSON Transcoding).
+func (v *Value) MarshalJSON() ([]byte, error) {
+	b := new(bytes.Buffer)
+	err := v.writeJSON(b)
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Representation of special floating point numbers in JSON.
+const (
+	jsonNaN    = "NaN"
+	jsonPosInf = "+Inf"
+	jsonNegInf = "-Inf"
+)
+
+// writeJSONFloat writes a floating point number of a given bit size as JSON.
+func writeJSONFloat(b *bytes.Buffer, f float64, bits int) {
+	switch {
+	case math.IsNaN(f):
+		writeJSONString(b, jsonNaN)
+	case math.IsInf(f, 1):
+		writeJSONString(b, jsonPosInf)
+	case math.IsInf(f, -1):
+		writeJSONString(b, jsonNegInf)
+	default:
+		b.WriteString(strconv.FormatFloat(f, 'g', -1, bits))
+	}
+}
+
+// writeJSONString writes a string as JSON.
+// Strings that are not valid UTF-8
+// are written as an object holding their bytes in base64.
+func writeJSONString(b *bytes.Buffer, s string) {
+	if !utf8.ValidString(s) {
+		b.WriteString(`{"bytes":`)
+		writeJSONString(b, base64.StdEncoding.EncodeToString([]byte(s)))
+		b.WriteString("}")
+		return
+	}
+	j, _ := json.Marshal(s)
+	b.Write(j)
+}
+
+// nullable tells if values of a type may be represented in JSON by null.
+func nullable(s *Signature) bool {
+	switch s.Kind {
+	case PointerKind, InterfaceKind, SliceKind, MapKind:
+		return true
+	}
+	return false
+}
+
+// writeJSON writes v as JSON.
+func (v *Value) writeJSON(b *bytes.Buffer) error {
+	s := v.Signature
+	if s == nil {
+		// Field of unknown ID
+		writeJSONString(b, base64.StdEncoding.EncodeToString(v.Bytes))
+		return nil
+	}
+	switch s.Kind {
+	case BasicKind:
+		switch s.Name {
+		case "bool":
+			b.WriteString(strconv.FormatBool(v.Bool))
+		case "string":
+			writeJSONString(b, v.String)
+		case "float32", "float64":
+			writeJSONFloat(b, v.Float, basicWidth(s.Name)*8)
+		case "complex64", "complex128":
+			b.WriteString("[")
+			writeJSONFloat(b, real(v.Complex), basicWidth(s.Name)*4)
+			b.WriteString(",")
+			writeJSONFloat(b, imag(v.Complex), basicWidth(s.Name)*4)
+			b.WriteString("]")
+		case "int", "int8", "int16", "int32", "int64":
+			b.WriteString(strconv.FormatInt(v.Int, 10))
+		default:
+			b.WriteString(strconv.FormatUint(v.Uint, 10))
+		}
+	case BuiltinKind:
+		return v.writeBuiltinJSON(b)
+	case MarshalerKind, BinaryMarshalerKind:
+		writeJSONString(b, base64.StdEncoding.EncodeToString(v.Bytes))
+	case PointerKind:
+		if v.Elem == nil {
+			b.WriteString("null")
+			return nil
+		}
+		if nullable(v.Elem.Signature) {
+			b.WriteString("[")
+			defer b.WriteString("]")
+		}
+		return v.Elem.writeJSON(b)
+	case InterfaceKind:
+		if v.String == "" {
+			b.WriteString("null")
+			return nil
+		}
+		if v.Elem == nil {
+			return fmt.Errorf("missing concrete value of '%s'", v.String)
+		}
+		b.WriteString(`{"type":`)
+		writeJSONString(b, v.String)
+		b.WriteString(`,"value":`)
+		err := v.Elem.writeJSON(b)
+		if err != nil {
+			return err
+		}
+		b.WriteString("}")
+	case MapKind:
+		if v.Nil {
+			b.WriteString("null")
+			return nil
+		}
+		if len(v.Keys) != len(v.Elems) {
+			return fmt.Errorf("map of %v keys holds %v elements", len(v.Keys), len(v.Elems))
+		}
+		object := s.Key.Kind == BasicKind && s.Key.Name == "string"
+		for _, k := range v.Keys {
+			object = object && utf8.ValidString(k.String)
+		}
+		if object {
+			b.WriteString("{")
+		} else {
+			b.WriteString("[")
+		}
+		for i := range v.Elems {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			if !object {
+				b.WriteString("[")
+			}
+			err := v.Keys[i].writeJSON(b)
+			if err != nil {
+				return err
+			}
+			if object {
+				b.WriteString(":")
+			} else {
+				b.WriteString(",")
+			}
+			err = v.Elems[i].writeJSON(b)
+			if err != nil {
+				return err
+			}
+			if !object {
+				b.WriteString("]")
+			}
+		}
+		if object {
+			b.WriteString("}")
+		} else {
+			b.WriteString("]")
+		}
+	case StructKind:
+		if s.Tagged {
+			if len(v.IDs) != len(v.Elems) {
+				return fmt.Errorf("struct of %v field IDs holds %v fields", len(v.IDs), len(v.Elems))
+			}
+			b.WriteString("{")
+			for i := range v.Elems {
+				if i > 0 {
+					b.WriteString(",")
+				}
+				b.WriteString(`"` + strconv.FormatUint(uint64(v.IDs[i]), 10) + `":`)
+				err := v.Elems[i].writeJSON(b)
+				if err != nil {
+					return err
+				}
+			}
+			b.WriteString("}")
+			return nil
+		}
+		fallthrough
+	case ArrayKind, SliceKind:
+		if v.Nil && s.Kind == SliceKind {
+			b.WriteString("null")
+			return nil
+		}
+		b.WriteString("[")
+		for i := range v.Elems {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			err := v.Elems[i].writeJSON(b)
+			if err != nil {
+				return err
+			}
+		}
+		b.WriteString("]")
+	default:
+		return fmt.Errorf("unknown signature kind %v", s.Kind)
+	}
+	return nil
+}
+
+// jsonTimeLayout is the layout of time.Time values in JSON.
+const jsonTimeLayout = "2006-01-02T15:04:05.999999999Z07:00:00"
+
+// jsonTime is the representation of time.Time values in JSON.
+// Instants whose years are out of the range of jsonTimeLayout
+// are represented by Unix, Nsec and Offset instead of Time.
+type jsonTime struct {
+	Time     string `json:"time,omitempty"`
+	Unix     *int64 `json:"unix,omitempty"`
+	Nsec     uint32 `json:"nsec,omitempty"`
+	Offset   int32  `json:"offset,omitempty"`
+	Location string `json:"location"`
+	Zone     string `json:"zone"`
+}
+
+// jsonBigFloat is the representation of big.Float values in JSON.
+type jsonBigFloat struct {
+	Value string `json:"value"`
+	Prec  uint   `json:"prec"`
+	Mode  uint8  `json:"mode"`
+	Acc   int8   `json:"acc"`
+}
+
+// layoutOf converts a Value of a type with built-in support
+// to a placeholder of its serialized form (see builtinLayouts).
+func layoutOf(v *Value, layout interface{}) error {
+	b := new(bytes.Buffer)
+	err := v.write(b)
+	if err != nil {
+		return err
+	}
+	e, err := New(layout)
+	if err != nil {
+		return err
+	}
+	_, err = e.ReadFrom(b)
+	return err
+}
+
+// valueOfLayout converts a placeholder of the serialized form
+// of a type with built-in support to a Value.
+func valueOfLayout(s *Signature, layout interface{}) (Value, error) {
+	b := new(bytes.Buffer)
+	e, err := New(layout)
+	if err != nil {
+		return Value{}, err
+	}
+	_, err = e.WriteTo(b)
+	if err != nil {
+		return Value{}, err
+	}
+	v, _, err := readValue(b, s, nil)
+	return v, err
+}
+
+// writeBuiltinJSON writes a Value of a type with built-in support as JSON.
+func (v *Value) writeBuiltinJSON(b *bytes.Buffer) error {
+	layout := reflect.New(reflect.TypeOf(builtinLayouts[v.Signature.Name]).Elem()).Interface()
+	err := layoutOf(v, layout)
+	if err != nil {
+		return err
+	}
+	var x interface{}
+	switch l := layout.(type) {
+	case *timeLayout:
+		j := jsonTime{Location: l.Location, Zone: l.Zone}
+		t := time.Unix(l.Sec, int64(l.Nsec)).In(time.FixedZone(l.Zone, int(l.Offset)))
+		if t.Year() >= 0 && t.Year() <= 9999 {
+			j.Time = t.Format(jsonTimeLayout)
+		} else {
+			j.Unix, j.Nsec, j.Offset = &l.Sec, l.Nsec, l.Offset
+		}
+		x = j
+	case *int64:
+		x = *l
+	case *bigIntLayout:
+		n := new(big.Int).SetBytes(l.Abs)
+		if l.Sign < 0 {
+			n.Neg(n)
+		}
+		x = json.Number(n.String())
+	case *bigRatLayout:
+		n := new(big.Int).SetBytes(l.Num)
+		if l.Sign < 0 {
+			n.Neg(n)
+		}
+		d := new(big.Int).SetBytes(l.Denom)
+		if d.Sign() == 0 {
+			d.SetInt64(1)
+		}
+		x = new(big.Rat).SetFrac(n, d).String()
+	case *[]byte:
+		f := new(big.Float)
+		err = f.GobDecode(*l)
+		if err != nil {
+			return err
+		}
+		x = jsonBigFloat{Value: f.Text('p', 0), Prec: f.Prec(), Mode: uint8(f.Mode()), Acc: int8(f.Acc())}
+	}
+	j, err := json.Marshal(x)
+	if err != nil {
+		return err
+	}
+	b.Write(j)
+	return nil
+}
+
+// valueFromJSON converts a decoded JSON value to a Value
+// of a given signature, whose enclosing types are in stack.
+func valueFromJSON(x interface{}, s *Signature, stack []*Signature) (Value, error) {
+	s, stack = resolve(s, stack)
+	v := Value{Signature: s}
+	mismatch := fmt.Errorf("cannot convert JSON %T to '%s'", x, s)
+	switch s.Kind {
+	case BasicKind:
+		return basicFromJSON(x, v, mismatch)
+	case BuiltinKind:
+		return builtinFromJSON(x, s)
+	case MarshalerKind, BinaryMarshalerKind:
+		str, ok := x.(string)
+		if !ok {
+			return v, mismatch
+		}
+		var err error
+		v.Bytes, err = base64.StdEncoding.DecodeString(str)
+		return v, err
+	}
+	stack = append(stack[:len(stack):len(stack)], s)
+	switch s.Kind {
+	case PointerKind:
+		if x == nil {
+			return v, nil
+		}
+		if nullable(resolveElem(s.Elem, stack)) {
+			a, ok := x.([]interface{})
+			if !ok || len(a) != 1 {
+				return v, fmt.Errorf("cannot convert JSON %T to '%s': expected an array of one element", x, s)
+			}
+			x = a[0]
+		}
+		elem, err := valueFromJSON(x, s.Elem, stack)
+		v.Elem = &elem
+		return v, err
+	case InterfaceKind:
+		if x == nil {
+			return v, nil
+		}
+		o, ok := x.(map[string]interface{})
+		if !ok {
+			return v, mismatch
+		}
+		v.String, ok = o["type"].(string)
+		if !ok || v.String == "" {
+			return v, fmt.Errorf("cannot convert JSON object to '%s': expected a type name", s)
+		}
+		concrete, err := registeredSignature(v.String)
+		if err != nil {
+			return v, err
+		}
+		elem, err := valueFromJSON(o["value"], concrete, nil)
+		v.Elem = &elem
+		return v, err
+	case ArrayKind, SliceKind:
+		if x == nil && s.Kind == SliceKind {
+			v.Nil = true
+			return v, nil
+		}
+		a, ok := x.([]interface{})
+		if !ok {
+			return v, mismatch
+		}
+		if s.Kind == ArrayKind && len(a) != s.Len {
+			return v, fmt.Errorf("cannot convert JSON array of %v elements to '%s'", len(a), s)
+		}
+		for _, e := range a {
+			elem, err := valueFromJSON(e, s.Elem, stack)
+			if err != nil {
+				return v, err
+			}
+			v.Elems = append(v.Elems, elem)
+		}
+		return v, nil
+	case MapKind:
+		if x == nil {
+			v.Nil = true
+			return v, nil
+		}
+		if o, ok := x.(map[string]interface{}); ok && s.Key.Kind == BasicKind && s.Key.Name == "string" {
+			keys := make([]string, 0, len(o))
+			for k := range o {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				elem, err := valueFromJSON(o[k], s.Elem, stack)
+				if err != nil {
+					return v, err
+				}
+				v.Keys = append(v.Keys, Value{Signature: s.Key, String: k})
+				v.Elems = append(v.Elems, elem)
+			}
+			return v, nil
+		}
+		a, ok := x.([]interface{})
+		if !ok {
+			return v, mismatch
+		}
+		for _, e := range a {
+			pair, ok := e.([]interface{})
+			if !ok || len(pair) != 2 {
+				return v, fmt.Errorf("cannot convert JSON to '%s': expected an array of key and element pairs", s)
+			}
+			key, err := valueFromJSON(pair[0], s.Key, stack)
+			if err != nil {
+				return v, err
+			}
+			elem, err := valueFromJSON(pair[1], s.Elem, stack)
+			if err != nil {
+				return v, err
+			}
+			v.Keys = append(v.Keys, key)
+			v.Elems = append(v.Elems, elem)
+		}
+		return v, nil
+	case StructKind:
+		if !s.Tagged {
+			a, ok := x.([]interface{})
+			if !ok {
+				return v, mismatch
+			}
+			if len(a) != len(s.Fields) {
+				return v, fmt.Errorf("cannot convert JSON array of %v elements to '%s'", len(a), s)
+			}
+			for i, f := range s.Fields {
+				elem, err := valueFromJSON(a[i], f.Type, stack)
+				if err != nil {
+					return v, err
+				}
+				v.Elems = append(v.Elems, elem)
+			}
+			return v, nil
+		}
+		o, ok := x.(map[string]interface{})
+		if !ok {
+			return v, mismatch
+		}
+		// Known fields come in the order of the signature,
+		// followed by unknown fields in order of ID.
+		var unknown []uint32
+		for k := range o {
+			id, err := strconv.ParseUint(k, 10, 32)
+			if err != nil || id == 0 {
+				return v, fmt.Errorf("cannot convert JSON object to '%s': invalid field ID '%s'", s, k)
+			}
+			if fieldType(s, uint32(id)) == nil {
+				unknown = append(unknown, uint32(id))
+			}
+		}
+		sort.Slice(unknown, func(i, j int) bool { return unknown[i] < unknown[j] })
+		for _, f := range s.Fields {
+			e, ok := o[strconv.FormatUint(uint64(f.ID), 10)]
+			if !ok {
+				continue
+			}
+			elem, err := valueFromJSON(e, f.Type, stack)
+			if err != nil {
+				return v, err
+			}
+			v.Elems = append(v.Elems, elem)
+			v.IDs = append(v.IDs, f.ID)
+		}
+		for _, id := range unknown {
+			str, ok := o[strconv.FormatUint(uint64(id), 10)].(string)
+			if !ok {
+				return v, fmt.Errorf("cannot convert JSON to field ID %v unknown to '%s': expected a base64 string", id, s)
+			}
+			data, err := base64.StdEncoding.DecodeString(str)
+			if err != nil {
+				return v, err
+			}
+			v.Elems = append(v.Elems, Value{Bytes: data})
+			v.IDs = append(v.IDs, id)
+		}
+		return v, nil
+	}
+	return v, fmt.Errorf("unknown signature kind %v", s.Kind)
+}
+
+// resolveElem resolves a signature whose enclosing types are in stack.
+func resolveElem(s *Signature, stack []*Signature) *Signature {
+	s, _ = resolve(s, stack)
+	return s
+}
+
+// fieldType answers the type of a field of a struct given its ID,
+// or nil if the ID is unknown.
+func fieldType(s *Signature, id uint32) *Signature {
+	for _, f := range s.Fields {
+		if f.ID == id {
+			return f.Type
+		}
+	}
+	return nil
+}
+
+// floatFromJSON converts a decoded JSON value to a floating point number
+// of a given bit size.
+func floatFromJSON(x interface{}, bits int) (float64, error) {
+	switch x := x.(type) {
+	case json.Number:
+		return strconv.ParseFloat(string(x), bits)
+	case string:
+		switch x {
+		case jsonNaN:
+			return math.NaN(), nil
+		case jsonPosInf:
+			return math.Inf(1), nil
+		case jsonNegInf:
+			return math.Inf(-1), nil
+		}
+	}
+	return 0, fmt.Errorf("cannot convert JSON %T to float%v", x, bits)
+}
+
+// stringFromJSON converts a decoded JSON value to a string.
+func stringFromJSON(x interface{}) (string, bool) {
+	switch x := x.(type) {
+	case string:
+		return x, true
+	case map[string]interface{}:
+		str, ok := x["bytes"].(string)
+		if !ok || len(x) != 1 {
+			return "", false
+		}
+		data, err := base64.StdEncoding.DecodeString(str)
+		return string(data), err == nil
+	}
+	return "", false
+}
+
+// basicFromJSON converts a decoded JSON value to a Value of a basic kind.
+func basicFromJSON(x interface{}, v Value, mismatch error) (Value, error) {
+	var err error
+	switch name := v.Signature.Name; name {
+	case "bool":
+		var ok bool
+		v.Bool, ok = x.(bool)
+		if !ok {
+			return v, mismatch
+		}
+	case "string":
+		var ok bool
+		v.String, ok = stringFromJSON(x)
+		if !ok {
+			return v, mismatch
+		}
+	case "float32", "float64":
+		v.Float, err = floatFromJSON(x, basicWidth(name)*8)
+	case "complex64", "complex128":
+		a, ok := x.([]interface{})
+		if !ok || len(a) != 2 {
+			return v, fmt.Errorf("cannot convert JSON %T to %s: expected an array of two numbers", x, name)
+		}
+		re, err := floatFromJSON(a[0], basicWidth(name)*4)
+		if err != nil {
+			return v, err
+		}
+		im, err := floatFromJSON(a[1], basicWidth(name)*4)
+		if err != nil {
+			return v, err
+		}
+		v.Complex = complex(re, im)
+	default:
+		n, ok := x.(json.Number)
+		if !ok {
+			return v, mismatch
+		}
+		bits := basicWidth(name) * 8
+		switch name {
+		case "int", "int8", "int16", "int32", "int64":
+			v.Int, err = strconv.ParseInt(string(n), 10, bits)
+		default:
+			v.Uint, err = strconv.ParseUint(string(n), 10, bits)
+		}
+	}
+	return v, err
+}
+
+// builtinFromJSON converts a decoded JSON value
+// to a Value of a type with built-in support.
+func builtinFromJSON(x interface{}, s *Signature) (Value, error) {
+	v := Value{Signature: s}
+	mismatch := fmt.Errorf("cannot convert JSON %T to '%s'", x, s)
+	// Decode JSON again into the representation of the type.
+	j, err := json.Marshal(x)
+	if err != nil {
+		return v, err
+	}
+	var layout interface{}
+	switch s.Name {
+	case "time.Time":
+		var jt jsonTime
+		err = json.Unmarshal(j, &jt)
+		if err != nil {
+			return v, mismatch
+		}
+		l := timeLayout{Location: jt.Location, Zone: jt.Zone}
+		if jt.Unix != nil {
+			l.Sec, l.Nsec, l.Offset = *jt.Unix, jt.Nsec, jt.Offset
+		} else {
+			t, err := time.Parse(jsonTimeLayout, jt.Time)
+			if err != nil {
+				return v, err
+			}
+			_, offset := t.Zone()
+			l.Sec, l.Nsec, l.Offset = t.Unix(), uint32(t.Nanosecond()), int32(offset)
+		}
+		layout = &l
+	case "time.Duration":
+		var d int64
+		err = json.Unmarshal(j, &d)
+		if err != nil {
+			return v, mismatch
+		}
+		layout = &d
+	case "big.Int":
+		n, ok := new(big.Int).SetString(string(j), 10)
+		if !ok {
+			return v, mismatch
+		}
+		layout = &bigIntLayout{Sign: int8(n.Sign()), Abs: n.Bytes()}
+	case "big.Rat":
+		str, _ := x.(string)
+		n, ok := new(big.Rat).SetString(str)
+		if !ok {
+			return v, mismatch
+		}
+		layout = &bigRatLayout{Sign: int8(n.Sign()), Num: n.Num().Bytes(), Denom: n.Denom().Bytes()}
+	case "big.Float":
+		var jf jsonBigFloat
+		err = json.Unmarshal(j, &jf)
+		if err != nil {
+			return v, mismatch
+		}
+		f := new(big.Float).SetPrec(jf.Prec).SetMode(big.RoundingMode(jf.Mode))
+		_, _, err = f.Parse(jf.Value, 0)
+		if err != nil {
+			return v, err
+		}
+		if jf.Prec == 0 {
+			// Parsing sets a precision of 64 bits.
+			f.SetPrec(0)
+		}
+		g, err := f.GobEncode()
+		if err != nil {
+			return v, err
+		}
+		// Restore the accuracy, which is not set by parsing
+		// but is part of the encoding (see big.Float.GobEncode).
+		g[1] = g[1]&^(3<<3) | byte(jf.Acc+1)&3<<3
+		layout = &g
+	default:
+		return v, fmt.Errorf("unknown built-in type %s", s.Name)
+	}
+	ls, err := builtinLayout(s.Name)
+	if err != nil {
+		return v, err
+	}
+	elem, err := valueOfLayout(ls, layout)
+	v.Elem = &elem
+	return v, err
+}
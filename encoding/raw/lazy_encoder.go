@@ -0,0 +1,67 @@
+// Copyright 2016 Rafael Lorandi <coolparadox@gmail.com>
+// This file is part of Raw, a binary encoder of Go types.
+//
+// Raw is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Raw is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Raw. If not, see <http://www.gnu.org/licenses/>.
+
+package raw
+
+import (
+	"io"
+	"reflect"
+	"strconv"
+)
+
+// lazyEncoder stands for a recursive occurrence of a type
+// (see Recursive Types).
+// The actual Encoder is created on first use,
+// so creation of Encoders of recursive types terminates.
+type lazyEncoder struct {
+	store   reflect.Value
+	up      int
+	builder *builder
+	worker  *Encoder
+}
+
+func (e lazyEncoder) Signature() string {
+	return "^" + strconv.Itoa(e.up)
+}
+
+// encoder answers the actual Encoder,
+// creating it on first use.
+func (e lazyEncoder) encoder() (Encoder, error) {
+	if *e.worker == nil {
+		w, err := e.builder.makeEncoder(e.store)
+		if err != nil {
+			return nil, err
+		}
+		*e.worker = w
+	}
+	return *e.worker, nil
+}
+
+func (e lazyEncoder) WriteTo(w io.Writer) (int64, error) {
+	worker, err := e.encoder()
+	if err != nil {
+		return 0, err
+	}
+	return worker.WriteTo(w)
+}
+
+func (e lazyEncoder) ReadFrom(r io.Reader) (int64, error) {
+	worker, err := e.encoder()
+	if err != nil {
+		return 0, err
+	}
+	return worker.ReadFrom(r)
+}
@@ -0,0 +1,107 @@
+// Copyright 2016 Rafael Lorandi <coolparadox@gmail.com>
+// This file is part of Raw, a binary encoder of Go types.
+//
+// Raw is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Raw is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Raw. If not, see <http://www.gnu.org/licenses/>.
+
+package raw
+
+import "io"
+
+// Limits restricts the recovery of data by an Encoder,
+// in defense against corrupt or hostile serialized data
+// (see Decoding Limits).
+// Zero fields impose no restriction.
+type Limits struct {
+
+	// MaxElements limits the number of elements
+	// of recovered slices and maps.
+	MaxElements int
+
+	// MaxStringLength limits the length of recovered strings
+	// and of byte sequences of types that serialize themselves.
+	MaxStringLength int
+
+	// MaxBytes limits the number of bytes consumed
+	// by a single recovery of the placeholder variable.
+	MaxBytes int64
+}
+
+// allocChunk is the maximum number of bytes allocated for a recovered
+// sequence before its elements are actually read.
+const allocChunk = 64 << 10
+
+// checkLimit verifies a length read from serialized data
+// against a limit.
+func checkLimit(limit string, max int, length uint64) error {
+	if max > 0 && length > uint64(max) {
+		return &LimitError{Limit: limit, Max: int64(max)}
+	}
+	return nil
+}
+
+// preallocLen answers the capacity to allocate
+// for a sequence of a given length and element size,
+// so that allocation grows with the data actually read.
+func preallocLen(length uint64, size uintptr) int {
+	// Divide instead of multiplying, which could overflow.
+	if size == 0 || length <= allocChunk/uint64(size) {
+		return int(length)
+	}
+	return allocChunk / int(size)
+}
+
+// readBytes reads a byte sequence of a given length,
+// allocating memory as bytes arrive.
+// Returns the sequence and the number of bytes read.
+func readBytes(r io.Reader, length uint64) ([]byte, int64, error) {
+	var nc int64
+	answer := make([]byte, 0, preallocLen(length, 1))
+	for uint64(len(answer)) < length {
+		chunk := length - uint64(len(answer))
+		if chunk > allocChunk {
+			chunk = allocChunk
+		}
+		start := len(answer)
+		answer = append(answer, make([]byte, chunk)...)
+		n, err := io.ReadFull(r, answer[start:])
+		nc += int64(n)
+		if err != nil {
+			return nil, nc, err
+		}
+	}
+	return answer, nc, nil
+}
+
+// byteLimitReader is a reader that fails with a LimitError
+// when more than MaxBytes are consumed.
+type byteLimitReader struct {
+	r         io.Reader
+	max       int64
+	remaining int64
+}
+
+func (l *byteLimitReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if l.remaining <= 0 {
+		return 0, &LimitError{Limit: "MaxBytes", Max: l.max}
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	return n, err
+}
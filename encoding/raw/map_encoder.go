@@ -17,8 +17,11 @@
 package raw
 
 import (
+	"bytes"
+	"fmt"
 	"io"
 	"reflect"
+	"sort"
 )
 
 type mapEncoder struct {
@@ -27,6 +30,11 @@ type mapEncoder struct {
 	keyWorkerStore  reflect.Value
 	elemWorker      Encoder
 	elemWorkerStore reflect.Value
+	max             int
+	canonical       bool
+	reuse           bool
+	preserveNil     bool
+	varint          bool
 }
 
 func (e mapEncoder) Signature() string {
@@ -34,10 +42,16 @@ func (e mapEncoder) Signature() string {
 }
 
 func (e mapEncoder) WriteTo(w io.Writer) (int64, error) {
-	var nc int64
 	storeVal := e.store.Elem()
+	if e.preserveNil && storeVal.IsNil() {
+		return marshalNilLength(e.varint, w)
+	}
+	if e.canonical {
+		return e.writeCanonical(w)
+	}
+	var nc int64
 	storeLen := storeVal.Len()
-	n, err := marshalInteger(uint64(storeLen), 4, w)
+	n, err := marshalLength(storeLen, e.varint, w)
 	nc += n
 	if err != nil {
 		return nc, err
@@ -56,7 +70,7 @@ func (e mapEncoder) WriteTo(w io.Writer) (int64, error) {
 		n, err = e.elemWorker.WriteTo(w)
 		nc += n
 		if err != nil {
-			return nc, err
+			return nc, prependPath(err, keyStep(keyVal))
 		}
 	}
 	return nc, nil
@@ -64,28 +78,131 @@ func (e mapEncoder) WriteTo(w io.Writer) (int64, error) {
 
 func (e mapEncoder) ReadFrom(r io.Reader) (int64, error) {
 	var nc int64
-	v, n, err := unmarshalInteger(r, 4)
+	v, n, err := unmarshalLength(r, e.varint)
 	nc += n
 	if err != nil {
 		return nc, err
 	}
+	if v == lengthOfNil {
+		e.store.Elem().Set(reflect.Zero(e.store.Elem().Type()))
+		return nc, nil
+	}
+	err = checkLimit("MaxElements", e.max, v)
+	if err != nil {
+		return nc, err
+	}
 	storeLen := int(v)
-	storeVal := reflect.MakeMap(e.store.Elem().Type())
-	e.store.Elem().Set(storeVal)
+	storeVal := e.store.Elem()
+	if e.reuse && !storeVal.IsNil() {
+		storeVal.Clear()
+	} else {
+		storeVal = reflect.MakeMap(storeVal.Type())
+		e.store.Elem().Set(storeVal)
+	}
 	keyWorkerVal := e.keyWorkerStore.Elem()
 	elemWorkerVal := e.elemWorkerStore.Elem()
+	key, previous := new(bytes.Buffer), new(bytes.Buffer)
 	for i := 0; i < storeLen; i++ {
-		n, err := e.keyWorker.ReadFrom(r)
+		var n int64
+		var err error
+		if e.reuse {
+			// Entries must not share allocations.
+			keyWorkerVal.Set(reflect.Zero(keyWorkerVal.Type()))
+			elemWorkerVal.Set(reflect.Zero(elemWorkerVal.Type()))
+		}
+		if e.canonical {
+			key.Reset()
+			n, err = e.keyWorker.ReadFrom(io.TeeReader(r, key))
+		} else {
+			n, err = e.keyWorker.ReadFrom(r)
+		}
 		nc += n
 		if err != nil {
-			return nc, err
+			// Map keys have no location of their own.
+			return nc, decodeError(err, "", nc-n, e.keyWorker.Signature())
+		}
+		if e.canonical && i > 0 {
+			switch bytes.Compare(previous.Bytes(), key.Bytes()) {
+			case 0:
+				return nc, fmt.Errorf("%w: duplicate map key %s", NonCanonicalError, keyStep(keyWorkerVal))
+			case 1:
+				return nc, fmt.Errorf("%w: map key %s out of order", NonCanonicalError, keyStep(keyWorkerVal))
+			}
 		}
+		previous, key = key, previous
 		n, err = e.elemWorker.ReadFrom(r)
 		nc += n
 		if err != nil {
-			return nc, err
+			return nc, decodeError(err, keyStep(keyWorkerVal), nc-n, e.elemWorker.Signature())
 		}
 		storeVal.SetMapIndex(keyWorkerVal, elemWorkerVal)
 	}
 	return nc, nil
 }
+
+// writeCanonical serializes a map with entries sorted by serialized key
+// (see Canonical Maps).
+func (e mapEncoder) writeCanonical(w io.Writer) (int64, error) {
+	storeVal := e.store.Elem()
+	keyWorkerVal := e.keyWorkerStore.Elem()
+	keys := storeVal.MapKeys()
+	encoded := make([][]byte, len(keys))
+	for i, keyVal := range keys {
+		b := new(bytes.Buffer)
+		keyWorkerVal.Set(keyVal)
+		_, err := e.keyWorker.WriteTo(b)
+		if err != nil {
+			return 0, err
+		}
+		encoded[i] = b.Bytes()
+	}
+	sort.Sort(byEncodedKey{keys, encoded})
+	var nc int64
+	n, err := marshalLength(len(keys), e.varint, w)
+	nc += n
+	if err != nil {
+		return nc, err
+	}
+	elemWorkerVal := e.elemWorkerStore.Elem()
+	for i, keyVal := range keys {
+		if i > 0 && bytes.Equal(encoded[i-1], encoded[i]) {
+			return nc, fmt.Errorf("%w: distinct map keys %s and %s serialize alike", NonCanonicalError, keyStep(keys[i-1]), keyStep(keyVal))
+		}
+		m, err := w.Write(encoded[i])
+		nc += int64(m)
+		if err != nil {
+			return nc, err
+		}
+		elemWorkerVal.Set(storeVal.MapIndex(keyVal))
+		n, err = e.elemWorker.WriteTo(w)
+		nc += n
+		if err != nil {
+			return nc, prependPath(err, keyStep(keyVal))
+		}
+	}
+	return nc, nil
+}
+
+// byEncodedKey sorts map keys by their serialized form.
+type byEncodedKey struct {
+	keys    []reflect.Value
+	encoded [][]byte
+}
+
+func (s byEncodedKey) Len() int {
+	return len(s.keys)
+}
+
+func (s byEncodedKey) Less(i, j int) bool {
+	return bytes.Compare(s.encoded[i], s.encoded[j]) < 0
+}
+
+func (s byEncodedKey) Swap(i, j int) {
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+	s.encoded[i], s.encoded[j] = s.encoded[j], s.encoded[i]
+}
+
+// keyStep formats a map key as a step in the location of an error.
+func keyStep(key reflect.Value) string {
+	return fmt.Sprintf("[%#v]", key.Interface())
+}
@@ -0,0 +1,180 @@
+// Copyright 2016 Rafael Lorandi <coolparadox@gmail.com>
+// This file is part of Raw, a binary encoder of Go types.
+//
+// Raw is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Raw is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Raw. If not, see <http://www.gnu.org/licenses/>.
+
+package raw
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// plan is an Encoder bound to a placeholder variable of its own,
+// used by Marshal and Unmarshal.
+type plan struct {
+	placeholder reflect.Value
+	encoder     Encoder
+	buf         bytes.Buffer
+}
+
+// maxFreePlans is the greatest number of free plans kept by a planList;
+// plans freed beyond it are left to garbage collection.
+const maxFreePlans = 16
+
+// maxPlanBuffer is the greatest capacity of the buffer
+// kept by a free plan;
+// greater buffers are left to garbage collection.
+const maxPlanBuffer = 64 << 10
+
+// planList is a free list of plans.
+// Unlike sync.Pool, it's not emptied by garbage collection,
+// so that Encoders are not created again,
+// but it keeps at most maxFreePlans plans.
+type planList struct {
+	mu   sync.Mutex
+	free []*plan
+}
+
+// get answers a free plan, or nil if there's none.
+func (l *planList) get() *plan {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.free) == 0 {
+		return nil
+	}
+	p := l.free[len(l.free)-1]
+	l.free = l.free[:len(l.free)-1]
+	return p
+}
+
+// put makes a plan free.
+func (l *planList) put(p *plan) {
+	l.mu.Lock()
+	if len(l.free) < maxFreePlans {
+		l.free = append(l.free, p)
+	}
+	l.mu.Unlock()
+}
+
+// plans maps types to lists of free plans (see Marshal).
+var plans sync.Map
+
+// newPlan creates a plan for a type.
+func newPlan(t reflect.Type, o Options) (*plan, error) {
+	placeholder := reflect.New(t)
+	e, err := NewWithOptions(placeholder.Interface(), o)
+	if err != nil {
+		return nil, err
+	}
+	return &plan{placeholder: placeholder, encoder: e}, nil
+}
+
+// clear clears the placeholder variable of a plan,
+// not to retain the last value while the plan is idle,
+// and drops its buffer if it grew beyond maxPlanBuffer.
+func (p *plan) clear() {
+	p.placeholder.Elem().Set(reflect.Zero(p.placeholder.Type().Elem()))
+	if p.buf.Cap() > maxPlanBuffer {
+		p.buf = bytes.Buffer{}
+	}
+}
+
+// getPlan answers a plan for a type,
+// to be returned by putPlan after use.
+func getPlan(t reflect.Type) (*plan, error) {
+	list, ok := plans.Load(t)
+	if !ok {
+		list, _ = plans.LoadOrStore(t, new(planList))
+	}
+	if p := list.(*planList).get(); p != nil {
+		return p, nil
+	}
+	return newPlan(t, Options{})
+}
+
+// putPlan makes a plan available for reuse.
+func putPlan(t reflect.Type, p *plan) {
+	p.clear()
+	list, _ := plans.Load(t)
+	list.(*planList).put(p)
+}
+
+/*
+Marshal serializes a value,
+answering the same data as the Encoder created by New
+for a placeholder variable of the type of v
+holding the value of v.
+
+The type of v is its dynamic type;
+a pointer is serialized as a pointer (see Supported Types).
+
+Marshal is safe for concurrent use.
+Encoders for each type are created once and cached,
+as many as the calls for the type running concurrently,
+up to a small limit.
+*/
+func Marshal(v interface{}) ([]byte, error) {
+	if v == nil {
+		return nil, fmt.Errorf("cannot marshal a nil interface")
+	}
+	t := reflect.TypeOf(v)
+	p, err := getPlan(t)
+	if err != nil {
+		return nil, err
+	}
+	defer putPlan(t, p)
+	p.placeholder.Elem().Set(reflect.ValueOf(v))
+	p.buf.Reset()
+	_, err = p.encoder.WriteTo(&p.buf)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), p.buf.Bytes()...), nil
+}
+
+/*
+Unmarshal recovers data serialized by Marshal,
+or by an Encoder created by New,
+into the variable pointed to by v.
+
+The data must be exactly the serialization of a single value;
+trailing bytes are an error.
+
+Unmarshal is safe for concurrent use.
+*/
+func Unmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("unmarshal target must be a non-nil pointer")
+	}
+	t := rv.Type().Elem()
+	p, err := getPlan(t)
+	if err != nil {
+		return err
+	}
+	defer putPlan(t, p)
+	r := bytes.NewReader(data)
+	_, err = p.encoder.ReadFrom(r)
+	if err != nil {
+		return err
+	}
+	if r.Len() > 0 {
+		return fmt.Errorf("%v trailing bytes after serialized data", r.Len())
+	}
+	rv.Elem().Set(p.placeholder.Elem())
+	return nil
+}
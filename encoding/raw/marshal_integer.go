@@ -16,7 +16,11 @@
 
 package raw
 
-import "io"
+import (
+	"fmt"
+	"io"
+	"math"
+)
 
 // marshalInteger marshals an unsigned integer number of a given octet depth.
 // Returns the number of bytes written.
@@ -32,9 +36,12 @@ func marshalInteger(value uint64, depth int, w io.Writer) (int64, error) {
 
 // unmarshalInteger unmarshals an unsigned integer number of a given octet depth.
 // Returns the unmarshaled value and the number of bytes read.
+// The sequence is read fully:
+// io.EOF is returned only if no bytes were read,
+// and io.ErrUnexpectedEOF if the sequence is incomplete.
 func unmarshalInteger(r io.Reader, depth int) (uint64, int64, error) {
 	sequence := make([]byte, depth, depth)
-	n, err := r.Read(sequence)
+	n, err := io.ReadFull(r, sequence)
 	if err != nil {
 		return 0, int64(n), err
 	}
@@ -45,3 +52,98 @@ func unmarshalInteger(r io.Reader, depth int) (uint64, int64, error) {
 	}
 	return answer, int64(n), nil
 }
+
+// maxFixedLength is the greatest length of a sequence
+// in fixed-size length fields;
+// greater values are reserved for nilLength.
+const maxFixedLength = nilLength - 1
+
+// lengthOfNil is the length answered by unmarshalLength
+// for nil slices and maps.
+const lengthOfNil = ^uint64(0)
+
+// marshalLength marshals the length of a sequence,
+// in 4 octets or, if varint is set, as a varint
+// (see Variable-Length Lengths).
+// Returns the number of bytes written.
+func marshalLength(length int, varint bool, w io.Writer) (int64, error) {
+	if varint {
+		return marshalVarint(uint64(length)+1, w)
+	}
+	if uint64(length) > maxFixedLength {
+		return 0, fmt.Errorf("%w: %v", LengthOverflowError, length)
+	}
+	return marshalInteger(uint64(length), 4, w)
+}
+
+// marshalNilLength marshals the length of a nil slice or map
+// (see Nil Slices and Maps).
+// Returns the number of bytes written.
+func marshalNilLength(varint bool, w io.Writer) (int64, error) {
+	if varint {
+		return marshalVarint(0, w)
+	}
+	return marshalInteger(nilLength, 4, w)
+}
+
+// unmarshalLength unmarshals the length of a sequence
+// marshaled by marshalLength or marshalNilLength.
+// Returns the length, or lengthOfNil, and the number of bytes read.
+func unmarshalLength(r io.Reader, varint bool) (uint64, int64, error) {
+	if !varint {
+		length, n, err := unmarshalInteger(r, 4)
+		if err == nil && length == nilLength {
+			length = lengthOfNil
+		}
+		return length, n, err
+	}
+	length, n, err := unmarshalVarint(r)
+	if err != nil {
+		return 0, n, err
+	}
+	if length > math.MaxInt {
+		return 0, n, fmt.Errorf("%w: %v", LengthOverflowError, length-1)
+	}
+	return length - 1, n, nil
+}
+
+// marshalVarint marshals an unsigned integer number
+// in groups of 7 bits, least significant first,
+// the high bit of each octet telling if more octets follow.
+// Returns the number of bytes written.
+func marshalVarint(value uint64, w io.Writer) (int64, error) {
+	var sequence [10]byte
+	i := 0
+	for ; value >= 0x80; i++ {
+		sequence[i] = byte(value) | 0x80
+		value >>= 7
+	}
+	sequence[i] = byte(value)
+	n, err := w.Write(sequence[:i+1])
+	return int64(n), err
+}
+
+// unmarshalVarint unmarshals an unsigned integer number
+// marshaled by marshalVarint.
+// Returns the unmarshaled value and the number of bytes read.
+func unmarshalVarint(r io.Reader) (uint64, int64, error) {
+	var answer uint64
+	var nc int64
+	for shift := uint(0); ; shift += 7 {
+		c, n, err := unmarshalInteger(r, 1)
+		nc += n
+		if err != nil {
+			if err == io.EOF && nc > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, nc, err
+		}
+		if shift == 63 && c > 1 {
+			return 0, nc, fmt.Errorf("varint overflows 64 bits")
+		}
+		answer |= (c & 0x7F) << shift
+		if c < 0x80 {
+			return answer, nc, nil
+		}
+	}
+}
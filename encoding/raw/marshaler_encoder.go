@@ -0,0 +1,201 @@
+// Copyright 2016 Rafael Lorandi <coolparadox@gmail.com>
+// This file is part of Raw, a binary encoder of Go types.
+//
+// Raw is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Raw is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Raw. If not, see <http://www.gnu.org/licenses/>.
+
+package raw
+
+import (
+	"encoding"
+	"io"
+	"reflect"
+)
+
+// Marshaler is the interface implemented by types
+// that serialize themselves (see Custom Serialization).
+//
+// MarshalRaw answers the serialized form of the value.
+type Marshaler interface {
+	MarshalRaw() ([]byte, error)
+}
+
+// Unmarshaler is the interface implemented by types
+// that recover themselves (see Custom Serialization).
+//
+// UnmarshalRaw recovers the value from a byte sequence
+// previously generated by MarshalRaw.
+// It must copy the data if it wishes to retain it after returning.
+type Unmarshaler interface {
+	UnmarshalRaw([]byte) error
+}
+
+var (
+	marshalerType         = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	unmarshalerType       = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+	binaryMarshalerType   = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+	binaryUnmarshalerType = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+)
+
+// marshalerEncoder serializes values of types
+// that serialize themselves (see Custom Serialization),
+// as the byte sequence they answer.
+type marshalerEncoder struct {
+	store   reflect.Value
+	binary  bool
+	ordered bool
+	max     int
+	varint  bool
+}
+
+// makeMarshalerEncoder answers an Encoder for a placeholder variable
+// whose type serializes itself,
+// or false if the type does not.
+func makeMarshalerEncoder(v reflect.Value, o Options) (Encoder, bool) {
+	if v.Type().Elem().Kind() == reflect.Interface {
+		return nil, false
+	}
+	t := v.Type().Elem()
+	if v.Type().Implements(marshalerType) && v.Type().Implements(unmarshalerType) && declares(t, "MarshalRaw", "UnmarshalRaw") {
+		return marshalerEncoder{store: v, ordered: o.Ordered, max: o.Limits.MaxStringLength, varint: o.VarintLengths}, true
+	}
+	if v.Type().Implements(binaryMarshalerType) && v.Type().Implements(binaryUnmarshalerType) && declares(t, "MarshalBinary", "UnmarshalBinary") {
+		return marshalerEncoder{store: v, binary: true, ordered: o.Ordered, max: o.Limits.MaxStringLength, varint: o.VarintLengths}, true
+	}
+	return nil, false
+}
+
+// declares tells if a type has methods of given names
+// that are not reachable through embedded fields.
+// A struct whose methods of custom serialization are promoted
+// does not serialize itself,
+// otherwise its other fields would be silently left out.
+// As reflection cannot tell a method declared by a struct
+// from one promoted with the same signature,
+// such methods are always taken as promoted.
+func declares(t reflect.Type, names ...string) bool {
+	if t.Kind() != reflect.Struct {
+		return true
+	}
+	for _, name := range names {
+		m, ok := t.MethodByName(name)
+		if !ok {
+			m, ok = reflect.PtrTo(t).MethodByName(name)
+		}
+		if ok && embeds(t, m) {
+			return false
+		}
+	}
+	return true
+}
+
+// embeds tells if a struct type has an embedded field
+// with a method of the same name and signature as a given one.
+func embeds(t reflect.Type, m reflect.Method) bool {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.Anonymous {
+			continue
+		}
+		em, ok := reflect.PtrTo(f.Type).MethodByName(m.Name)
+		if !ok {
+			em, ok = f.Type.MethodByName(m.Name)
+		}
+		if ok && sameMethodType(m.Type, em.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameMethodType tells if method types of different receivers
+// have the same parameters and results.
+func sameMethodType(a, b reflect.Type) bool {
+	if a.NumIn() != b.NumIn() || a.NumOut() != b.NumOut() || a.IsVariadic() != b.IsVariadic() {
+		return false
+	}
+	for i := 1; i < a.NumIn(); i++ {
+		if a.In(i) != b.In(i) {
+			return false
+		}
+	}
+	for i := 0; i < a.NumOut(); i++ {
+		if a.Out(i) != b.Out(i) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e marshalerEncoder) Signature() string {
+	if e.binary {
+		return "binary(" + e.store.Type().Elem().String() + ")"
+	}
+	return "raw(" + e.store.Type().Elem().String() + ")"
+}
+
+func (e marshalerEncoder) WriteTo(w io.Writer) (int64, error) {
+	var b []byte
+	var err error
+	if e.binary {
+		b, err = e.store.Interface().(encoding.BinaryMarshaler).MarshalBinary()
+	} else {
+		b, err = e.store.Interface().(Marshaler).MarshalRaw()
+	}
+	if err != nil {
+		return 0, err
+	}
+	if e.ordered {
+		return writeOrderedBytes(w, b)
+	}
+	var nc int64
+	n, err := marshalLength(len(b), e.varint, w)
+	nc += n
+	if err != nil {
+		return nc, err
+	}
+	m, err := w.Write(b)
+	nc += int64(m)
+	return nc, err
+}
+
+func (e marshalerEncoder) ReadFrom(r io.Reader) (int64, error) {
+	var nc int64
+	var b []byte
+	if e.ordered {
+		var err error
+		b, nc, err = readOrderedBytes(r, e.max)
+		if err != nil {
+			return nc, err
+		}
+	} else {
+		v, n, err := unmarshalLength(r, e.varint)
+		nc += n
+		if err != nil {
+			return nc, err
+		}
+		err = checkLimit("MaxStringLength", e.max, v)
+		if err != nil {
+			return nc, err
+		}
+		b, n, err = readBytes(r, v)
+		nc += n
+		if err != nil {
+			return nc, err
+		}
+	}
+	if e.binary {
+		return nc, e.store.Interface().(encoding.BinaryUnmarshaler).UnmarshalBinary(b)
+	}
+	return nc, e.store.Interface().(Unmarshaler).UnmarshalRaw(b)
+}
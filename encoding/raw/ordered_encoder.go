@@ -0,0 +1,109 @@
+// Copyright 2016 Rafael Lorandi <coolparadox@gmail.com>
+// This file is part of Raw, a binary encoder of Go types.
+//
+// Raw is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Raw is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Raw. If not, see <http://www.gnu.org/licenses/>.
+
+package raw
+
+import (
+	"bytes"
+	"io"
+)
+
+// orderedEncoder adapts an Encoder of numbers to the ordered format
+// (see Ordered Data).
+//
+// Serialized data of the adapted Encoder
+// is composed of count little endian numbers of width bytes
+// (signed integers already shifted to be positive).
+// Each number is reversed to big endian order
+// and, if it's floating point, transformed so that
+// byte-wise comparison matches numeric comparison.
+type orderedEncoder struct {
+	worker Encoder
+	width  int
+	count  int
+	float  bool
+}
+
+func (e orderedEncoder) Signature() string {
+	return e.worker.Signature()
+}
+
+func (e orderedEncoder) WriteTo(w io.Writer) (int64, error) {
+	b := new(bytes.Buffer)
+	_, err := e.worker.WriteTo(b)
+	if err != nil {
+		return 0, err
+	}
+	sequence := b.Bytes()
+	for i := 0; i < e.count; i++ {
+		number := sequence[i*e.width : (i+1)*e.width]
+		reverse(number)
+		if e.float {
+			orderFloat(number)
+		}
+	}
+	n, err := w.Write(sequence)
+	return int64(n), err
+}
+
+func (e orderedEncoder) ReadFrom(r io.Reader) (int64, error) {
+	sequence := make([]byte, e.width*e.count)
+	n, err := io.ReadFull(r, sequence)
+	if err != nil {
+		return int64(n), err
+	}
+	for i := 0; i < e.count; i++ {
+		number := sequence[i*e.width : (i+1)*e.width]
+		if e.float {
+			unorderFloat(number)
+		}
+		reverse(number)
+	}
+	_, err = e.worker.ReadFrom(bytes.NewReader(sequence))
+	return int64(n), err
+}
+
+// reverse reverses the order of a byte sequence.
+func reverse(b []byte) {
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+}
+
+// orderFloat transforms the big endian bits of a floating point number
+// so that byte-wise comparison matches numeric comparison:
+// negative numbers have all bits flipped,
+// and positive numbers have the sign bit set.
+func orderFloat(b []byte) {
+	if b[0]&0x80 != 0 {
+		for i := range b {
+			b[i] = ^b[i]
+		}
+	} else {
+		b[0] |= 0x80
+	}
+}
+
+// unorderFloat reverts orderFloat.
+func unorderFloat(b []byte) {
+	if b[0]&0x80 != 0 {
+		b[0] &^= 0x80
+	} else {
+		for i := range b {
+			b[i] = ^b[i]
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2016 Rafael Lorandi <coolparadox@gmail.com>
+// This file is part of Raw, a binary encoder of Go types.
+//
+// Raw is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Raw is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Raw. If not, see <http://www.gnu.org/licenses/>.
+
+package raw
+
+import (
+	"fmt"
+	"io"
+)
+
+// Special bytes of strings in ordered format (see Ordered Data).
+const (
+	orderedEscape     = 0x00
+	orderedTerminator = 0x01
+	orderedEscaped    = 0xFF
+)
+
+// orderedStringEncoder serializes strings in ordered format
+// (see Ordered Data).
+type orderedStringEncoder struct {
+	store *string
+	max   int
+}
+
+func (orderedStringEncoder) Signature() string {
+	return "string"
+}
+
+func (e orderedStringEncoder) WriteTo(w io.Writer) (int64, error) {
+	return writeOrderedBytes(w, []byte(*e.store))
+}
+
+func (e orderedStringEncoder) ReadFrom(r io.Reader) (int64, error) {
+	answer, n, err := readOrderedBytes(r, e.max)
+	if err != nil {
+		return n, err
+	}
+	*e.store = string(answer)
+	return n, nil
+}
+
+// writeOrderedBytes serializes a byte sequence in ordered format.
+// Returns the number of bytes written.
+func writeOrderedBytes(w io.Writer, b []byte) (int64, error) {
+	sequence := make([]byte, 0, len(b)+2)
+	for _, c := range b {
+		sequence = append(sequence, c)
+		if c == orderedEscape {
+			sequence = append(sequence, orderedEscaped)
+		}
+	}
+	sequence = append(sequence, orderedEscape, orderedTerminator)
+	n, err := w.Write(sequence)
+	return int64(n), err
+}
+
+// readOrderedBytes recovers a byte sequence in ordered format.
+// Returns the recovered sequence and the number of bytes read.
+// Parameter max limits the length of the sequence (see Limits).
+func readOrderedBytes(r io.Reader, max int) ([]byte, int64, error) {
+	var nc int64
+	var answer []byte
+	for {
+		c, n, err := unmarshalInteger(r, 1)
+		nc += n
+		if err != nil {
+			return nil, nc, err
+		}
+		if c == orderedEscape {
+			c, n, err = unmarshalInteger(r, 1)
+			nc += n
+			if err != nil {
+				return nil, nc, err
+			}
+			switch c {
+			case orderedTerminator:
+				return answer, nc, nil
+			case orderedEscaped:
+				c = orderedEscape
+			default:
+				return nil, nc, fmt.Errorf("invalid escape sequence in ordered string")
+			}
+		}
+		err = checkLimit("MaxStringLength", max, uint64(len(answer))+1)
+		if err != nil {
+			return nil, nc, err
+		}
+		answer = append(answer, byte(c))
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2016 Rafael Lorandi <coolparadox@gmail.com>
+// This file is part of Raw, a binary encoder of Go types.
+//
+// Raw is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Raw is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Raw. If not, see <http://www.gnu.org/licenses/>.
+
+package raw
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// prefixedEncoder precedes serialized data of a composite value
+// with its length in bytes, so that the value can be skipped
+// (see Length-Prefixed Composites).
+type prefixedEncoder struct {
+	worker Encoder
+	varint bool
+}
+
+func (e prefixedEncoder) Signature() string {
+	return e.worker.Signature()
+}
+
+func (e prefixedEncoder) WriteTo(w io.Writer) (int64, error) {
+	var nc int64
+	b := new(bytes.Buffer)
+	_, err := e.worker.WriteTo(b)
+	if err != nil {
+		return nc, err
+	}
+	n, err := marshalLength(b.Len(), e.varint, w)
+	nc += n
+	if err != nil {
+		return nc, err
+	}
+	n, err = b.WriteTo(w)
+	nc += n
+	return nc, err
+}
+
+func (e prefixedEncoder) ReadFrom(r io.Reader) (int64, error) {
+	var nc int64
+	length, n, err := unmarshalLength(r, e.varint)
+	nc += n
+	if err != nil {
+		return nc, err
+	}
+	if length == lengthOfNil {
+		return nc, fmt.Errorf("invalid length of composite value")
+	}
+	n, err = e.worker.ReadFrom(io.LimitReader(r, int64(length)))
+	nc += n
+	if err != nil {
+		return nc, decodeError(err, "", nc-n, e.worker.Signature())
+	}
+	if n != int64(length) {
+		return nc, fmt.Errorf("composite value: expected %v bytes, consumed %v", length, n)
+	}
+	return nc, nil
+}
@@ -0,0 +1,203 @@
+// Copyright 2016 Rafael Lorandi <coolparadox@gmail.com>
+// This file is part of Raw, a binary encoder of Go types.
+//
+// Raw is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Raw is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Raw. If not, see <http://www.gnu.org/licenses/>.
+
+package raw
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// projection is a tree of struct field paths
+// selected for recovery (see Projections).
+// A selected field maps to nil if it's recovered whole,
+// or to the projection of its own fields.
+type projection struct {
+	fields map[string]*projection
+}
+
+// makeProjection creates the projection of given field paths.
+func makeProjection(paths []string) (*projection, error) {
+	root := &projection{fields: make(map[string]*projection)}
+	for _, path := range paths {
+		if path == "" {
+			return nil, fmt.Errorf("empty field path")
+		}
+		p := root
+		steps := strings.Split(path, ".")
+		for i, step := range steps {
+			if step == "" {
+				return nil, fmt.Errorf("field path '%s' has an empty step", path)
+			}
+			child, ok := p.fields[step]
+			if ok && child == nil {
+				// Field already selected whole
+				break
+			}
+			if i == len(steps)-1 {
+				p.fields[step] = nil
+				break
+			}
+			if !ok {
+				child = &projection{fields: make(map[string]*projection)}
+				p.fields[step] = child
+			}
+			p = child
+		}
+	}
+	return root, nil
+}
+
+// unknown verifies that the selected fields of a projection
+// are serialized fields of a struct.
+func (p *projection) unknown(t reflect.Type, fields []structField) error {
+	known := make(map[string]bool)
+	for _, f := range fields {
+		known[f.Name] = true
+	}
+	var names []string
+	for name := range p.fields {
+		if !known[name] {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+	return fmt.Errorf("struct %s has no field %s", t, strings.Join(names, ", "))
+}
+
+/*
+NewProjection creates an Encoder like NewWithOptions,
+whose recovery of data populates only given field paths
+of the placeholder variable (see Projections).
+
+A field path is a sequence of struct field names separated by dots,
+eg. "Header.ID".
+Steps across pointers, arrays and slices
+apply to the pointed value or to every element,
+eg. "Lines.Qty" for a slice of structs in field Lines.
+
+Returns an Encoder bound to the placeholder variable.
+*/
+func NewProjection(placeholder interface{}, o Options, paths ...string) (Encoder, error) {
+	if o.Ordered {
+		return nil, fmt.Errorf("projections are not supported in ordered format")
+	}
+	if o.TrackReferences {
+		return nil, fmt.Errorf("projections cannot track references")
+	}
+	p, err := makeProjection(paths)
+	if err != nil {
+		return nil, err
+	}
+	return newEncoder(placeholder, o, p)
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+	bigIntType   = reflect.TypeOf(big.Int{})
+	bigFloatType = reflect.TypeOf(big.Float{})
+	bigRatType   = reflect.TypeOf(big.Rat{})
+)
+
+// skippable tells if serialized data of a type
+// can be skipped without being recovered.
+func skippable(t reflect.Type, o Options) bool {
+	switch t {
+	case durationType:
+		return true
+	case timeType, bigIntType, bigFloatType, bigRatType:
+		return o.LengthPrefixed
+	}
+	if _, ok := makeMarshalerEncoder(reflect.New(t), o); ok {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Array, reflect.Slice, reflect.Map, reflect.Struct, reflect.Interface:
+		return o.LengthPrefixed
+	case reflect.Ptr:
+		return skippable(t.Elem(), o)
+	}
+	return true
+}
+
+// skipWidths maps kinds of fixed size to their serialized width.
+var skipWidths = map[reflect.Kind]int64{
+	reflect.Bool:       1,
+	reflect.Int:        8,
+	reflect.Int8:       1,
+	reflect.Int16:      2,
+	reflect.Int32:      4,
+	reflect.Int64:      8,
+	reflect.Uint:       8,
+	reflect.Uint8:      1,
+	reflect.Uint16:     2,
+	reflect.Uint32:     4,
+	reflect.Uint64:     8,
+	reflect.Uintptr:    8,
+	reflect.Float32:    4,
+	reflect.Float64:    8,
+	reflect.Complex64:  8,
+	reflect.Complex128: 16,
+}
+
+// skip skips serialized data of a skippable type.
+// Returns the number of bytes skipped.
+func skip(r io.Reader, t reflect.Type, o Options) (int64, error) {
+	if t == durationType {
+		return io.CopyN(io.Discard, r, 8)
+	}
+	if t.Kind() == reflect.Ptr {
+		var nc int64
+		marker, n, err := unmarshalInteger(r, 1)
+		nc += n
+		if err != nil || marker == ptrNil {
+			return nc, err
+		}
+		if marker != ptrValue {
+			return nc, fmt.Errorf("invalid pointer marker %#x", marker)
+		}
+		n, err = skip(r, t.Elem(), o)
+		nc += n
+		return nc, err
+	}
+	if width, ok := skipWidths[t.Kind()]; ok {
+		if _, ok := makeMarshalerEncoder(reflect.New(t), o); !ok {
+			return io.CopyN(io.Discard, r, width)
+		}
+	}
+	// Data preceded by its length
+	var nc int64
+	length, n, err := unmarshalLength(r, o.VarintLengths)
+	nc += n
+	if err != nil {
+		return nc, err
+	}
+	if length == lengthOfNil {
+		return nc, fmt.Errorf("invalid length of skipped value")
+	}
+	n, err = io.CopyN(io.Discard, r, int64(length))
+	nc += n
+	return nc, err
+}
@@ -16,13 +16,23 @@
 
 package raw
 
+import "fmt"
 import "io"
 import "reflect"
 
+// Markers of serialized pointers.
+const (
+	ptrNil       = 0x00
+	ptrValue     = 0xFF
+	ptrReference = 0x01
+)
+
 type ptrEncoder struct {
 	worker      Encoder
 	workerStore reflect.Value
 	store       reflect.Value
+	refs        *references
+	reuse       bool
 }
 
 func (e ptrEncoder) Signature() string {
@@ -33,14 +43,27 @@ func (e ptrEncoder) WriteTo(w io.Writer) (int64, error) {
 	var nc int64
 	storeVal := e.store.Elem()
 	if reflect.DeepEqual(storeVal.Interface(), reflect.Zero(storeVal.Type()).Interface()) {
-		n, err := marshalInteger(0x00, 1, w)
+		n, err := marshalInteger(ptrNil, 1, w)
 		nc += n
 		return nc, err
 	}
-	n, err := marshalInteger(0xFF, 1, w)
+	if e.refs != nil {
+		id, seen := e.refs.id(storeVal)
+		if seen {
+			n, err := marshalInteger(ptrReference, 1, w)
+			nc += n
+			if err != nil {
+				return nc, err
+			}
+			n, err = marshalInteger(uint64(id), 4, w)
+			nc += n
+			return nc, err
+		}
+	}
+	n, err := marshalInteger(ptrValue, 1, w)
 	nc += n
 	if err != nil {
-		return nc, nil
+		return nc, err
 	}
 	workerVal := e.workerStore.Elem()
 	workerVal.Set(storeVal.Elem())
@@ -57,16 +80,48 @@ func (e ptrEncoder) ReadFrom(r io.Reader) (int64, error) {
 		return n, err
 	}
 	storeVal := e.store.Elem()
-	if v == 0 {
+	if v == ptrNil {
 		storeVal.Set(reflect.Zero(storeVal.Type()))
 		return nc, nil
 	}
-	storeVal.Set(reflect.New(storeVal.Type().Elem()))
+	if v == ptrReference && e.refs != nil {
+		id, n, err := unmarshalInteger(r, 4)
+		nc += n
+		if err != nil {
+			return nc, err
+		}
+		if id >= uint64(len(e.refs.ptrs)) {
+			return nc, fmt.Errorf("reference to unknown pointed value %v", id)
+		}
+		ptr := e.refs.ptrs[id]
+		if ptr.Type() != storeVal.Type() {
+			return nc, fmt.Errorf("reference to pointed value %v of type %s, expected %s", id, ptr.Type(), storeVal.Type())
+		}
+		storeVal.Set(ptr)
+		return nc, nil
+	}
+	ptr := storeVal
+	workerVal := e.workerStore.Elem()
+	if e.reuse && !ptr.IsNil() {
+		workerVal.Set(ptr.Elem())
+	} else {
+		ptr = reflect.New(storeVal.Type().Elem())
+		if e.reuse {
+			// The pointed value must not share allocations.
+			workerVal.Set(reflect.Zero(workerVal.Type()))
+		}
+	}
+	if e.refs != nil {
+		// Remember pointer before recovering its value,
+		// so it can be referenced by its own value.
+		e.refs.add(ptr)
+	}
 	n, err = e.worker.ReadFrom(r)
 	nc += n
 	if err != nil {
-		return nc, err
+		return nc, decodeError(err, "", nc-n, e.worker.Signature())
 	}
-	storeVal.Elem().Set(e.workerStore.Elem())
+	ptr.Elem().Set(workerVal)
+	storeVal.Set(ptr)
 	return nc, nil
 }
@@ -28,12 +28,20 @@ To recover the typed value of a byte sequence
 previously generated by WriteTo or Read,
 use ReadFrom or Write.
 
+For one-off serialization without a placeholder variable,
+use Marshal and Unmarshal,
+which answer the same data as Encoders created by New
+and are safe for concurrent use.
+A Codec does the same for a given type,
+detecting type mistakes at compile time.
+
 Suported Types
 
 Types of the following kinds are supported by Raw:
 bool,
-int8, int16, int32, int64,
-uint8, uint16, uint32, uint64,
+int, int8, int16, int32, int64,
+uint, uint8, uint16, uint32, uint64,
+uintptr,
 float32, float64,
 complex64, complex128,
 string,
@@ -41,35 +49,55 @@ array of any supported type,
 map of any supported type,
 pointer to any supported type,
 slice of any supported type,
-struct with fields of any supported type.
+struct with fields of any supported type,
+interface holding a value of a registered type (see Interfaces),
+time.Time, time.Duration, big.Int, big.Float, big.Rat
+(see Time and Big Numbers),
+any type that serializes itself (see Custom Serialization).
+
+Values of big.Int, big.Float and big.Rat are always recovered
+into newly allocated values,
+as the placeholder may be a shallow copy of another value
+sharing its internal storage.
 
 Unsupported Types
 
 Types of the following kinds are not supported:
-int, uint, uintptr (their size is platform dependent);
 unsafe pointer (not meaningful across systems);
-chan, func, interface (language plumbing).
+chan, func (language plumbing).
 
 Remarks
 
 The placeholder variable (see New)
 is the access point to typed data for a given Encoder.
 The Encoder is eternally bound to its placeholder variable.
+Encoders are not safe for concurrent use,
+not even for concurrent serialization,
+since inner Encoders share variables of their own;
+use Codec, Marshal or Unmarshal for concurrent use.
 
-Structs must have all fields exported.
+Structs must have all fields exported,
+unless fields are left out (see Struct Tags).
 
-Recovery of array, map, ptr or slice always creates new values
-(there is no reuse of allocated resources).
+Recovery of map, ptr or slice creates new values,
+unless reuse of allocated resources is requested
+(see Reuse of Allocations).
+
+Values of kinds int, uint and uintptr are always serialized as 64 bit integers.
+Recovery fails if a value does not fit in the platform size of its kind.
 
 A nil map or slice is serialized as if it was
-an empty map or slice.
+an empty map or slice,
+unless nil is preserved (see Nil Slices and Maps).
 
-Length of slices and maps is silently assumed
-to fit in uint32 during serialization.
+Length of slices, maps and strings is serialized in 4 bytes,
+and serialization fails with LengthOverflowError
+for lengths that do not fit
+(see Variable-Length Lengths).
 
 Caveats
 
-Serialized data does not contain type information.
+By default serialized data does not contain type information.
 It's up to the programmer to ensure that
 recovery is performed by an Encoder created
 after the same type kind of the Encoder that
@@ -77,6 +105,437 @@ generated the serialized data.
 One way of achieving this
 is to compare Encoder's signatures (see Signature).
 
+Struct Tags
+
+By default struct fields are serialized by position,
+so adding, removing or reordering fields of a struct
+renders previously serialized data unrecoverable.
+
+Fields may be given stable IDs by means of raw tags:
+
+	type Person struct {
+	    Name string `raw:"1"`
+	    Age  uint8  `raw:"2"`
+	}
+
+Field IDs are positive integers that must be unique within a struct.
+Either all fields of a struct have IDs or none has.
+Each field of a struct with field IDs is serialized
+together with its ID and the length of its serialized data.
+On recovery,
+fields with IDs unknown to the receiving struct are skipped,
+and fields absent from serialized data are set to their zero value.
+Therefore fields can be added, removed or reordered,
+as long as IDs of removed fields are not reused
+and fields keep their types.
+
+Fields tagged with "-" are not serialized,
+and are left untouched on recovery,
+eg. caches or mutexes of a domain type:
+
+	type Account struct {
+	    Balance int64
+	    mu      sync.Mutex `raw:"-"`
+	}
+
+Unexported fields are not supported,
+unless they are tagged with "-"
+or the IgnoreUnexported option is set (see Options),
+which leaves them out as well.
+
+Embedded structs are serialized as regular fields by default.
+With the PromoteEmbedded option set (see Options),
+fields of embedded structs are promoted instead:
+they are serialized as fields of the embedding struct,
+in place of the embedded field,
+and are named as such in projections (see Projections).
+Promotion changes signatures of embedding structs,
+so data serialized with and without it are not compatible.
+Promotion follows the rules of Go selectors:
+a promoted field is hidden by a field of the same name
+in a shallower level of embedding,
+and fields of ambiguous names are not serialized.
+Embedded fields given a field ID,
+of types with built-in support (see Time and Big Numbers),
+of types that serialize themselves (see Custom Serialization)
+or of pointer types
+are serialized as regular fields.
+
+Time and Big Numbers
+
+Some types of the standard library have built-in support,
+and their own tokens in signatures.
+
+Values of time.Time are serialized as
+seconds and nanoseconds since January 1, 1970 UTC,
+followed by the name of their location,
+and the name and offset of their zone.
+The monotonic clock reading is not preserved.
+On recovery the location is looked up by name;
+if it's unknown, or if its offset differs from the serialized one,
+a fixed zone with the serialized zone name and offset is used instead,
+so the wall clock is always preserved.
+
+Values of time.Duration are serialized as int64 values.
+
+Values of big.Int are serialized as their sign
+followed by the bytes of their absolute value.
+Values of big.Rat are serialized as their sign
+followed by the bytes of the absolute values of their numerator and denominator.
+Values of big.Float are serialized as answered by their GobEncode method,
+which preserves precision, rounding mode and accuracy.
+In ordered format (see Ordered Data)
+values of big.Int, big.Float and big.Rat do not sort by numeric value.
+
+Custom Serialization
+
+Types may control their own serialization by implementing
+Marshaler and Unmarshaler,
+or encoding.BinaryMarshaler and encoding.BinaryUnmarshaler,
+with either value or pointer receivers.
+Such types are serialized as the byte sequence answered by
+MarshalRaw (or MarshalBinary),
+regardless of their kind,
+so they may have unexported fields.
+Marshaler takes precedence over encoding.BinaryMarshaler.
+Structs that get such methods from embedded fields,
+eg. a struct embedding time.Time,
+do not serialize themselves,
+and are serialized field by field.
+Since reflection cannot tell promoted methods
+from methods of the same signature declared by the struct itself,
+this holds even if the struct declares them;
+a struct serializing itself must hold such values in named fields.
+
+The signature of such types names the type and the interface it implements,
+eg. "raw(money.Amount)" or "binary(uuid.UUID)",
+so that changing the serialization of a type changes signatures.
+
+Interfaces
+
+Concrete types of interface values must be registered
+under a name that identifies them in serialized data
+(see Register):
+
+	type Event interface{ When() int64 }
+	type Click struct{ At int64; X, Y int32 }
+	func (c Click) When() int64 { return c.At }
+
+	raw.Register("click", Click{})
+
+Interface values are serialized as the registered name of the concrete type
+followed by the serialized concrete value.
+Recovery of interface values creates new values of the registered type.
+Serialization or recovery of values of unregistered types
+fail with UnregisteredTypeError,
+annotated with the location of the interface value
+within the placeholder variable.
+
+References
+
+By default each pointer is serialized together with the value it points to.
+Pointers sharing the same value are recovered
+pointing to distinct copies of the value,
+and serialization of pointers that form a cycle never ends.
+
+Encoders created by NewWithOptions with TrackReferences set
+serialize each pointed value only once,
+on its first occurrence,
+and further pointers to it as references to this occurrence.
+On recovery such pointers are made to share the same value again,
+including pointers that form cycles
+(eg. a tree whose nodes point back to their parents).
+
+Recursive Types
+
+Types that contain themselves
+through pointers, slices or maps,
+such as
+
+	type Node struct {
+	    Value int64
+	    Next  *Node
+	}
+
+are supported.
+In signatures, each recursive occurrence of a type is represented
+by a caret followed by the number of levels up
+to its enclosing occurrence,
+eg. the signature of Node is "struct { int64; *^2 }".
+
+Ordered Data
+
+Encoders created by NewWithOptions with Ordered set
+serialize data in a format whose byte-wise comparison
+(see bytes.Compare)
+matches the natural ordering of the original values,
+so serialized data can be used as keys of sorted indexes.
+
+In ordered format,
+numbers are serialized in big endian order,
+with signed integers shifted to be positive
+and floating point numbers transformed so that negative numbers
+sort before positive ones
+(negative zero sorts before positive zero,
+and NaNs sort beyond infinities).
+Strings are serialized as their bytes
+terminated by the pair 0x00 0x01,
+with bytes 0x00 escaped as the pair 0x00 0xFF.
+Each element of a slice is preceded by 0x01,
+and the slice is terminated by 0x00.
+Arrays and structs are compared element by element, and field by field.
+A nil pointer sorts before any other pointer,
+and pointers sort like the values they point to.
+Booleans sort false before true.
+
+The ordered format supports neither maps, interfaces, structs with field IDs,
+nor reference tracking.
+
+Nil Slices and Maps
+
+By default, nil slices and maps are serialized like empty ones,
+and are recovered as empty.
+Encoders created by NewWithOptions with PreserveNil set
+serialize nil slices and maps with the length 0xFFFFFFFF,
+so they are recovered as nil.
+All Encoders recover such lengths as nil,
+so data serialized with or without PreserveNil is recovered by any Encoder,
+with empty slices and maps of data serialized without PreserveNil
+recovered as empty.
+The ordered format does not support PreserveNil.
+
+Variable-Length Lengths
+
+By default the length of a slice, map, string,
+self-serialized byte sequence or struct with field IDs
+is serialized as a 4 byte integer,
+which fits lengths up to 0xFFFFFFFE
+(0xFFFFFFFF being the length of nil slices and maps).
+Serialization of longer values fails with LengthOverflowError.
+
+Encoders created by NewWithOptions with VarintLengths set
+serialize a length n as the number n+1
+in groups of 7 bits, least significant first,
+with the high bit of each byte telling if more bytes follow;
+0 is the length of nil slices and maps.
+Lengths up to 126 then take a single byte,
+and lengths are limited only by the platform size of int.
+Data serialized with VarintLengths is recovered
+only by Encoders with VarintLengths set, and vice versa.
+The ordered format does not support VarintLengths,
+since it serializes no lengths.
+
+Reuse of Allocations
+
+Encoders created by NewWithOptions with Reuse set
+recover data into the resources already allocated
+in the placeholder variable, reducing allocations
+when recovering many values into the same placeholder:
+slices whose capacity suffices are resliced
+and have their elements recovered in place,
+maps are cleared and refilled with newly created entries,
+and non-nil pointers have their pointed values recovered in place.
+Other values are created as usual.
+
+Values previously recovered into the placeholder variable,
+or copied from it, may share such resources
+and are then overwritten by a new recovery.
+
+Canonical Maps
+
+Go maps have no order,
+so by default the same map may serialize to different data each time.
+Encoders created by NewWithOptions with CanonicalMaps set
+serialize map entries sorted by the serialized form of their keys
+(see bytes.Compare),
+so that equal values always serialize alike,
+eg. for hashing or comparing serialized data.
+Such Encoders recover only maps whose keys are sorted
+and not repeated,
+so that every value has a single serialized form;
+NonCanonicalError is returned otherwise,
+including when distinct keys serialize alike (eg. pointers to equal values).
+Serialized data is otherwise identical to the format of New.
+Canonical maps are not supported with reference tracking.
+
+Length-Prefixed Composites
+
+Encoders created by NewWithOptions with LengthPrefixed set
+precede serialized data of each array, slice, map, struct
+and interface value
+with its length in bytes,
+serialized like other lengths (see Variable-Length Lengths),
+so that the value can be skipped without being recovered.
+Data serialized with LengthPrefixed is recovered
+only by Encoders with LengthPrefixed set, and vice versa.
+The ordered format does not support LengthPrefixed.
+
+Projections
+
+NewProjection creates an Encoder
+that recovers only selected struct fields of the placeholder variable,
+leaving other fields with their zero values:
+
+	type Order struct {
+		ID    int64
+		Lines []Line
+		Notes string
+	}
+	var order Order
+	e, err := raw.NewProjection(&order, raw.Options{LengthPrefixed: true}, "ID", "Lines.Qty")
+
+Data of fields not selected is skipped:
+values of fixed size, strings and types that serialize themselves
+are always skipped without being recovered,
+while other values are skipped by their length
+only if composites are length-prefixed,
+and are otherwise recovered and discarded.
+Serialization by a projection covers the whole placeholder variable,
+including fields not selected.
+Projections are not supported in ordered format,
+nor with reference tracking,
+and cannot select fields beyond a recursive reference.
+
+Record Streams
+
+Serialized data of an Encoder has no framing,
+so values written back to back cannot be told apart
+once a single byte is corrupt.
+A StreamWriter writes the placeholder variable as a record of a stream,
+eg. an append-only log of typed values,
+and a StreamReader reads records back one at a time:
+
+	w := raw.NewStreamWriter(f, encoder)
+	err = w.WriteRecord()
+	...
+	r := raw.NewStreamReader(f, encoder)
+	for {
+		err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if errors.Is(err, raw.CorruptRecordError) {
+			continue
+		}
+		...
+	}
+
+Each record is framed by a 16 byte header:
+a 4 byte marker (0xE2 'R' 'W' 0x9C),
+the length of the serialized data,
+its CRC32C checksum (see hash/crc32),
+and the CRC32C checksum of the preceding bytes of the header,
+all integers in 4 bytes, least significant first.
+After a corrupt record,
+Next skips data up to the next marker that starts an intact header.
+
+Generated Encoders
+
+Encoders created by New rely on reflection.
+For hot paths,
+the read_writer_gen tool can generate a reflection-free Serializer
+for a named type,
+whose signature and serialized data are identical to
+those of an Encoder created by New:
+
+	//go:generate go run github.com/coolparadox/go/encoding/raw/read_writer_gen -type Person
+
+The above generates file person_raw.go,
+with function NewPersonRawEncoder
+that binds the generated Serializer to a placeholder variable
+and answers an Encoder (see Wrap).
+Generated Serializers use the format of New
+(ie. the format of NewWithOptions with zero Options)
+and support the kinds of types listed in Supported Types,
+with the exception of interfaces,
+types with built-in support
+and types that serialize themselves.
+
+Decoding Limits
+
+By default, recovery trusts the lengths found in serialized data,
+which may be corrupt or hostile.
+Memory for recovered strings and slices is allocated
+as their contents are actually read,
+so that a bogus length alone cannot exhaust memory;
+still, applications handling untrusted data
+should restrict recovery with the Limits field of Options:
+
+	e, err := raw.NewWithOptions(&v, raw.Options{Limits: raw.Limits{
+		MaxElements:     1 << 16,
+		MaxStringLength: 1 << 20,
+		MaxBytes:        1 << 24,
+	}})
+
+Data exceeding a limit fails to be recovered
+with an error of type *LimitError.
+
+Type Signatures
+
+The Signature method of Encoders answers a textual description
+of the serialized format,
+eg. "struct { []int32; map[string]*float64 }".
+ParseSignature turns a signature back into a structured description,
+and Compatible tells if data serialized under a signature
+can be recovered under another one, and why not.
+
+Given a signature,
+ReadValue recovers serialized data into a generic Value
+without a placeholder variable of the original type,
+eg. for inspecting data in tools unaware of it.
+A Value serializes back to identical data.
+
+JSON Transcoding
+
+ToJSON converts serialized data of a signature to JSON,
+and FromJSON converts it back.
+Conversion is lossless,
+with values represented in JSON as follows:
+
+	bool                  true or false
+	integers              numbers
+	float32, float64      numbers, or "NaN", "+Inf" or "-Inf"
+	complex64, complex128 arrays of real and imaginary parts
+	string                strings, or {"bytes": base64 string}
+	                      if not valid UTF-8
+	array, slice          arrays
+	map                   objects, if keys are strings valid in UTF-8;
+	                      otherwise arrays of [key, element] pairs
+	nil slice or map      null (see Nil Slices and Maps)
+	struct                arrays of fields;
+	                      objects keyed by field ID if fields have IDs,
+	                      with base64 strings of serialized data
+	                      for IDs unknown to the signature
+	pointer               null if nil, otherwise the pointed value;
+	                      [pointed value] if it's a pointer, interface,
+	                      slice or map
+	interface             null if nil,
+	                      otherwise {"type": name, "value": value}
+	                      (see Register)
+	time.Time             {"time": "2006-01-02T15:04:05.999999999Z07:00:00",
+	                      "location": name, "zone": abbreviation};
+	                      out of years 0 to 9999, "time" is replaced by
+	                      "unix", "nsec" and "offset" in seconds
+	time.Duration         numbers of nanoseconds
+	big.Int               numbers
+	big.Float             {"value": mantissa and exponent as by Text('p', 0),
+	                      "prec": precision, "mode": rounding mode,
+	                      "acc": accuracy}
+	big.Rat               strings "numerator/denominator"
+	raw(T), binary(T)     base64 strings
+
+NaN values recover as the NaN of package math.
+
+Self-describing Data
+
+Encoders created by NewWithOptions with SelfDescribing set
+precede serialized data with a type header
+carrying the Encoder's signature.
+On recovery the header is verified against the signature of the receiving Encoder,
+and SignatureMismatchError is returned if they differ.
+This way serialized data can travel through files and pipes
+without a side channel for signatures.
+
 Whish List
 
 Document syntax of serialized data.
@@ -88,7 +547,10 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"math/big"
 	"reflect"
+	"strconv"
+	"time"
 )
 
 /*
@@ -109,20 +571,40 @@ previously generated by WriteTo or Read,
 and populates the placeholder variable
 with recovered data.
 Returns the number of bytes read.
+If the io.Reader has no data at all,
+io.EOF is returned;
+if data ends before the sequence is complete,
+the error wraps io.ErrUnexpectedEOF.
 
 Read writes to a byte slice
 a sequence of bytes
 representing the contents of the placeholder variable.
-If the sequence does not fit into the slice,
-io.ErrShortBuffer is returned.
+The sequence is streamed across successive calls:
+the placeholder variable is serialized on the first call,
+and each call answers the next part of the sequence
+that fits into the slice.
+Once the sequence is exhausted,
+io.EOF is returned
+and the next call serializes the placeholder variable again.
 Returns the number of bytes written.
 
 Write reads from a byte slice
 a sequence of bytes
 previously generated by Read or WriteTo,
-ans populates the placeholder variable
+and populates the placeholder variable
 with recovered data.
+The sequence may be split across successive calls;
+each call resumes recovery where the previous one stopped,
+so while the sequence is incomplete
+the placeholder variable may be partially populated;
+its contents are meaningful only after
+the call that completes the sequence.
+Meanwhile recovery waits for the next call in its own goroutine;
+calling ReadFrom, WriteTo or Read abandons an incomplete sequence.
 Returns the number of bytes read.
+If the slice goes beyond the end of the sequence,
+the extra bytes are not read
+and the error wraps TrailingDataError.
 */
 type Encoder interface {
 	Signature() string
@@ -141,96 +623,499 @@ The resulting Encoder uses this variable as a placeholder of typed data.
 Returns an Encoder bound to the placeholder variable.
 */
 func New(placeholder interface{}) (Encoder, error) {
-	return makeEncoder(reflect.ValueOf(placeholder))
+	return NewWithOptions(placeholder, Options{})
+}
+
+// Options tunes the serialization format of an Encoder
+// (see NewWithOptions).
+// The zero value selects the format used by New.
+type Options struct {
+
+	// SelfDescribing makes the Encoder precede serialized data
+	// with a type header (see Self-describing Data).
+	SelfDescribing bool
+
+	// TrackReferences makes the Encoder preserve
+	// sharing of pointed values (see References).
+	TrackReferences bool
+
+	// Ordered makes the Encoder serialize data
+	// in a format that sorts like the original values
+	// (see Ordered Data).
+	Ordered bool
+
+	// CanonicalMaps makes the Encoder serialize map entries
+	// sorted by serialized key,
+	// and reject recovery of maps otherwise
+	// (see Canonical Maps).
+	CanonicalMaps bool
+
+	// PreserveNil makes the Encoder distinguish
+	// nil slices and maps from empty ones
+	// (see Nil Slices and Maps).
+	PreserveNil bool
+
+	// VarintLengths makes the Encoder serialize lengths
+	// of slices, maps, strings and byte sequences
+	// in a variable number of bytes
+	// (see Variable-Length Lengths).
+	VarintLengths bool
+
+	// LengthPrefixed makes the Encoder precede serialized data
+	// of composite values with their length,
+	// so that they can be skipped by projections
+	// (see Length-Prefixed Composites).
+	LengthPrefixed bool
+
+	// IgnoreUnexported makes the Encoder leave out
+	// unexported struct fields,
+	// instead of failing on them (see Struct Tags).
+	IgnoreUnexported bool
+
+	// PromoteEmbedded makes the Encoder serialize fields
+	// of embedded structs as fields of the embedding struct
+	// (see Struct Tags).
+	PromoteEmbedded bool
+
+	// Reuse makes the Encoder recover data
+	// into the allocated resources of the placeholder variable
+	// without affecting the serialization format
+	// (see Reuse of Allocations).
+	Reuse bool
+
+	// Limits restricts the recovery of data
+	// without affecting the serialization format
+	// (see Decoding Limits).
+	Limits Limits
+}
+
+/*
+NewWithOptions creates an Encoder for a type,
+using a tuned serialization format.
+
+Parameter placeholder has the same meaning as in New.
+
+Returns an Encoder bound to the placeholder variable.
+*/
+func NewWithOptions(placeholder interface{}, o Options) (Encoder, error) {
+	return newEncoder(placeholder, o, nil)
+}
+
+// newEncoder creates an Encoder for a type,
+// recovering only the field paths of a projection, if any.
+func newEncoder(placeholder interface{}, o Options, p *projection) (Encoder, error) {
+	if o.Ordered && o.TrackReferences {
+		return nil, fmt.Errorf("ordered format cannot track references")
+	}
+	if o.Ordered && o.PreserveNil {
+		return nil, fmt.Errorf("ordered format cannot preserve nil slices")
+	}
+	if o.Ordered && o.VarintLengths {
+		return nil, fmt.Errorf("ordered format has no lengths to serialize as varints")
+	}
+	if o.Ordered && o.LengthPrefixed {
+		return nil, fmt.Errorf("ordered format cannot prefix composites with lengths")
+	}
+	if o.CanonicalMaps && o.TrackReferences {
+		return nil, fmt.Errorf("canonical maps cannot track references")
+	}
+	b := &builder{options: o, project: p}
+	if o.TrackReferences {
+		b.refs = new(references)
+	}
+	w, err := b.makeEncoder(reflect.ValueOf(placeholder))
+	if err != nil {
+		return nil, err
+	}
+	e := &rootEncoder{worker: w, refs: b.refs, maxBytes: o.Limits.MaxBytes}
+	if o.SelfDescribing {
+		e.header = makeHeader(w.Signature(), FormatFlags(o))
+	}
+	return e, nil
+}
+
+/*
+Serializer is the part of Encoder
+that serializes and recovers data,
+as implemented by encoders generated by read_writer_gen
+(see Generated Encoders).
+*/
+type Serializer interface {
+	Signature() string
+	io.WriterTo
+	io.ReaderFrom
+}
+
+// Wrap creates an Encoder from a Serializer,
+// adding the streaming Read and Write methods of Encoders.
+func Wrap(s Serializer) Encoder {
+	return &rootEncoder{worker: s}
+}
+
+// builder holds the context of the creation of an Encoder
+// and its inner Encoders.
+type builder struct {
+	options Options
+
+	// refs is shared by all pointer Encoders
+	// if references are tracked.
+	refs *references
+
+	// stack holds the types whose Encoders are under creation,
+	// for detecting recursive types.
+	stack []reflect.Type
+
+	// project holds the field paths to be recovered
+	// by the Encoder under creation,
+	// or nil if the whole value is recovered (see Projections).
+	project *projection
+}
+
+// fresh answers a builder in the same context of b,
+// suitable for creating Encoders after b is done.
+func (b *builder) fresh() *builder {
+	return &builder{options: b.options, refs: b.refs}
 }
 
 // makeEncoder creates an Encoder.
-func makeEncoder(v reflect.Value) (Encoder, error) {
-	var err error
+//
+// The Encoder of a type that contains itself (a recursive type)
+// is created on demand on each level of recursion
+// (see lazyEncoder).
+func (b *builder) makeEncoder(v reflect.Value) (Encoder, error) {
 	if v.Kind() != reflect.Ptr {
 		return nil, fmt.Errorf("placeholder variable must be passed by reference")
 	}
+	t := v.Type().Elem()
+	for i := len(b.stack) - 1; i >= 0; i-- {
+		if b.stack[i] == t {
+			if b.project != nil {
+				return nil, fmt.Errorf("cannot project fields of recursive type %s", t)
+			}
+			return lazyEncoder{store: v, up: len(b.stack) - i, builder: b.fresh(), worker: new(Encoder)}, nil
+		}
+	}
+	b.stack = append(b.stack, t)
+	defer func() { b.stack = b.stack[:len(b.stack)-1] }()
 	k := v.Elem().Kind()
+	if b.project != nil {
+		switch k {
+		case reflect.Struct, reflect.Ptr, reflect.Array, reflect.Slice:
+		default:
+			return nil, fmt.Errorf("cannot project fields of %s", t)
+		}
+	}
+	if e, ok, err := b.makeBuiltinEncoder(v); ok {
+		if b.project != nil {
+			return nil, fmt.Errorf("cannot project fields of %s", t)
+		}
+		return e, err
+	}
+	if e, ok := makeMarshalerEncoder(v, b.options); ok {
+		if b.project != nil {
+			return nil, fmt.Errorf("cannot project fields of %s", t)
+		}
+		return e, nil
+	}
 	switch k {
 	default:
 		return nil, fmt.Errorf("unsupported data type: %s", k)
+	case reflect.Uint:
+		return b.order(uintEncoder{kindPtr(v, uint(0)).(*uint)}, 8, 1, false), nil
+	case reflect.Uintptr:
+		return b.order(uintptrEncoder{kindPtr(v, uintptr(0)).(*uintptr)}, 8, 1, false), nil
 	case reflect.Uint8:
-		return uint8Encoder{v.Interface().(*uint8)}, nil
+		return uint8Encoder{kindPtr(v, uint8(0)).(*uint8)}, nil
 	case reflect.Uint16:
-		return uint16Encoder{v.Interface().(*uint16)}, nil
+		return b.order(uint16Encoder{kindPtr(v, uint16(0)).(*uint16)}, 2, 1, false), nil
 	case reflect.Uint32:
-		return uint32Encoder{v.Interface().(*uint32)}, nil
+		return b.order(uint32Encoder{kindPtr(v, uint32(0)).(*uint32)}, 4, 1, false), nil
 	case reflect.Uint64:
-		return uint64Encoder{v.Interface().(*uint64)}, nil
+		return b.order(uint64Encoder{kindPtr(v, uint64(0)).(*uint64)}, 8, 1, false), nil
+	case reflect.Int:
+		return b.order(intEncoder{kindPtr(v, int(0)).(*int)}, 8, 1, false), nil
 	case reflect.Int8:
-		return int8Encoder{v.Interface().(*int8)}, nil
+		return int8Encoder{kindPtr(v, int8(0)).(*int8)}, nil
 	case reflect.Int16:
-		return int16Encoder{v.Interface().(*int16)}, nil
+		return b.order(int16Encoder{kindPtr(v, int16(0)).(*int16)}, 2, 1, false), nil
 	case reflect.Int32:
-		return int32Encoder{v.Interface().(*int32)}, nil
+		return b.order(int32Encoder{kindPtr(v, int32(0)).(*int32)}, 4, 1, false), nil
 	case reflect.Int64:
-		return int64Encoder{v.Interface().(*int64)}, nil
+		return b.order(int64Encoder{kindPtr(v, int64(0)).(*int64)}, 8, 1, false), nil
 	case reflect.Float32:
-		return float32Encoder{v.Interface().(*float32)}, nil
+		return b.order(float32Encoder{kindPtr(v, float32(0)).(*float32)}, 4, 1, true), nil
 	case reflect.Float64:
-		return float64Encoder{v.Interface().(*float64)}, nil
+		return b.order(float64Encoder{kindPtr(v, float64(0)).(*float64)}, 8, 1, true), nil
 	case reflect.Complex64:
-		return complex64Encoder{v.Interface().(*complex64)}, nil
+		return b.order(complex64Encoder{kindPtr(v, complex64(0)).(*complex64)}, 4, 2, true), nil
 	case reflect.Complex128:
-		return complex128Encoder{v.Interface().(*complex128)}, nil
+		return b.order(complex128Encoder{kindPtr(v, complex128(0)).(*complex128)}, 8, 2, true), nil
 	case reflect.Bool:
-		return boolEncoder{v.Interface().(*bool)}, nil
+		return boolEncoder{kindPtr(v, false).(*bool)}, nil
 	case reflect.String:
-		return stringEncoder{v.Interface().(*string)}, nil
+		if b.options.Ordered {
+			return orderedStringEncoder{store: kindPtr(v, "").(*string), max: b.options.Limits.MaxStringLength}, nil
+		}
+		return stringEncoder{store: kindPtr(v, "").(*string), max: b.options.Limits.MaxStringLength, varint: b.options.VarintLengths}, nil
 	case reflect.Array:
 		ws := reflect.New(v.Type().Elem().Elem())
-		w, err := makeEncoder(ws)
+		w, err := b.makeEncoder(ws)
 		if err != nil {
 			return nil, fmt.Errorf("cannot make encoder for array: %s", err)
 		}
-		return arrayEncoder{worker: w, workerStore: ws, store: v}, nil
+		return b.prefix(arrayEncoder{worker: w, workerStore: ws, store: v, reuse: b.options.Reuse}), nil
 	case reflect.Slice:
 		ws := reflect.New(v.Type().Elem().Elem())
-		w, err := makeEncoder(ws)
+		w, err := b.makeEncoder(ws)
 		if err != nil {
 			return nil, fmt.Errorf("cannot make encoder for slice: %s", err)
 		}
-		return sliceEncoder{worker: w, workerStore: ws, store: v}, nil
+		return b.prefix(sliceEncoder{worker: w, workerStore: ws, store: v, ordered: b.options.Ordered, max: b.options.Limits.MaxElements, reuse: b.options.Reuse, preserveNil: b.options.PreserveNil, varint: b.options.VarintLengths}), nil
 	case reflect.Map:
+		if b.options.Ordered {
+			return nil, fmt.Errorf("maps are not supported in ordered format")
+		}
 		kws := reflect.New(v.Type().Elem().Key())
-		kw, err := makeEncoder(kws)
+		kw, err := b.makeEncoder(kws)
 		if err != nil {
 			return nil, fmt.Errorf("cannot make encoder for map: %s", err)
 		}
 		ews := reflect.New(v.Type().Elem().Elem())
-		ew, err := makeEncoder(ews)
+		ew, err := b.makeEncoder(ews)
 		if err != nil {
 			return nil, fmt.Errorf("cannot make encoder for map: %s", err)
 		}
-		return mapEncoder{keyWorker: kw, keyWorkerStore: kws, elemWorker: ew, elemWorkerStore: ews, store: v}, nil
+		return b.prefix(mapEncoder{keyWorker: kw, keyWorkerStore: kws, elemWorker: ew, elemWorkerStore: ews, store: v, max: b.options.Limits.MaxElements, canonical: b.options.CanonicalMaps, reuse: b.options.Reuse, preserveNil: b.options.PreserveNil, varint: b.options.VarintLengths}), nil
 	case reflect.Struct:
 		v = v.Elem()
-		n := v.NumField()
+		sf, err := structFields(v.Type(), b.options)
+		if err != nil {
+			return nil, err
+		}
+		n := len(sf)
 		store := make([]Encoder, n, n)
-		for i := 0; i < n; i++ {
-			f := v.Type().Field(i)
-			if f.PkgPath != "" {
-				return nil, fmt.Errorf("struct field '%s' is unexported", f.Name)
+		names := make([]string, n, n)
+		ids := make([]uint32, n, n)
+		tagged := 0
+		project := b.project
+		if project != nil {
+			err = project.unknown(v.Type(), sf)
+			if err != nil {
+				return nil, err
+			}
+		}
+		defer func() { b.project = project }()
+		for i, f := range sf {
+			ids[i] = f.id
+			if ids[i] != 0 {
+				tagged++
 			}
-			store[i], err = makeEncoder(v.Field(i).Addr())
+			names[i] = f.Name
+			var selected bool
+			if project != nil {
+				b.project, selected = project.fields[f.Name]
+			}
+			store[i], err = b.makeEncoder(v.FieldByIndex(f.Index).Addr())
 			if err != nil {
-				return nil, fmt.Errorf("cannot make encoder for struct field %s: %s", v.Type().Field(i).Name, err)
+				return nil, fmt.Errorf("cannot make encoder for struct field %s: %s", f.Name, err)
+			}
+			if project != nil && !selected {
+				store[i] = skipEncoder{worker: store[i], store: v.FieldByIndex(f.Index).Addr(), options: b.options}
+			}
+		}
+		if tagged == 0 {
+			return b.prefix(structEncoder{store: store, names: names}), nil
+		}
+		if tagged < n {
+			return nil, fmt.Errorf("struct has fields both with and without field IDs")
+		}
+		if b.options.Ordered {
+			return nil, fmt.Errorf("structs with field IDs are not supported in ordered format")
+		}
+		fields := make([]reflect.Value, n, n)
+		for i := 0; i < n; i++ {
+			fields[i] = v.FieldByIndex(sf[i].Index)
+			for j := 0; j < i; j++ {
+				if ids[i] == ids[j] {
+					return nil, fmt.Errorf("struct fields %s and %s share field ID %v", names[j], names[i], ids[i])
+				}
 			}
 		}
-		return structEncoder{store}, nil
+		return b.prefix(taggedStructEncoder{store: store, names: names, ids: ids, fields: fields, varint: b.options.VarintLengths}), nil
+	case reflect.Interface:
+		if b.options.Ordered {
+			return nil, fmt.Errorf("interfaces are not supported in ordered format")
+		}
+		return b.prefix(interfaceEncoder{store: v, builder: b.fresh(), workers: make(map[reflect.Type]interfaceWorker)}), nil
 	case reflect.Ptr:
 		ws := reflect.New(v.Type().Elem().Elem())
-		w, err := makeEncoder(ws)
+		w, err := b.makeEncoder(ws)
 		if err != nil {
 			return nil, fmt.Errorf("cannot make encoder for pointer: %s", err)
 		}
-		return ptrEncoder{worker: w, workerStore: ws, store: v}, nil
+		return ptrEncoder{worker: w, workerStore: ws, store: v, refs: b.refs, reuse: b.options.Reuse}, nil
+	}
+}
+
+// fieldID answers the field ID of a struct field,
+// taken from its raw tag (see Struct Tags).
+// Returns zero if the field has no field ID.
+func fieldID(f reflect.StructField) (uint32, error) {
+	tag := f.Tag.Get("raw")
+	if tag == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseUint(tag, 10, 32)
+	if err != nil || id == 0 {
+		return 0, fmt.Errorf("struct field %s has invalid field ID '%s'", f.Name, tag)
+	}
+	return uint32(id), nil
+}
+
+// structField is a serialized field of a struct,
+// possibly promoted from embedded structs (see Struct Tags).
+// Index is the sequence of indexes for reaching the field
+// (see reflect.Value.FieldByIndex).
+type structField struct {
+	reflect.StructField
+	id    uint32
+	depth int
+}
+
+// structFields answers the serialized fields of a struct type,
+// in order of serialization.
+func structFields(t reflect.Type, o Options) ([]structField, error) {
+	fields, err := collectFields(t, o, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	// Hide promoted fields like Go selectors do:
+	// the shallowest field of a name wins,
+	// and ambiguous names are left out.
+	depths := make(map[string]int)
+	counts := make(map[string]int)
+	for _, f := range fields {
+		d, ok := depths[f.Name]
+		switch {
+		case !ok || f.depth < d:
+			depths[f.Name] = f.depth
+			counts[f.Name] = 1
+		case f.depth == d:
+			counts[f.Name]++
+		}
+	}
+	answer := fields[:0]
+	for _, f := range fields {
+		if depths[f.Name] == f.depth && counts[f.Name] == 1 {
+			answer = append(answer, f)
+		}
+	}
+	return answer, nil
+}
+
+// collectFields answers the serialized fields of a struct type
+// and of the structs it embeds, before hiding,
+// given the index sequence and the name path of the struct itself.
+func collectFields(t reflect.Type, o Options, index []int, path string) ([]structField, error) {
+	var fields []structField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("raw")
+		if tag == "-" {
+			continue
+		}
+		f.Index = append(append([]int(nil), index...), i)
+		if o.PromoteEmbedded && f.Anonymous && tag == "" && promoted(f.Type, o) {
+			inner, err := collectFields(f.Type, o, f.Index, path+f.Name+".")
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, inner...)
+			continue
+		}
+		if f.PkgPath != "" {
+			if o.IgnoreUnexported {
+				continue
+			}
+			return nil, fmt.Errorf("struct field '%s' is unexported", path+f.Name)
+		}
+		id, err := fieldID(f)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, structField{StructField: f, id: id, depth: len(index)})
+	}
+	return fields, nil
+}
+
+// promoted tells if fields of an embedded type
+// are promoted to the embedding struct (see Struct Tags).
+func promoted(t reflect.Type, o Options) bool {
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	switch t {
+	case timeType, bigIntType, bigFloatType, bigRatType:
+		return false
+	}
+	_, ok := makeMarshalerEncoder(reflect.New(t), o)
+	return !ok
+}
+
+// makeBuiltinEncoder answers an Encoder for a placeholder variable
+// of a type with built-in support (see Time and Big Numbers),
+// or false if the type has no built-in support.
+func (b *builder) makeBuiltinEncoder(v reflect.Value) (Encoder, bool, error) {
+	switch p := v.Interface().(type) {
+	case *time.Time:
+		layout := new(timeLayout)
+		w, err := b.makeEncoder(reflect.ValueOf(layout))
+		return timeEncoder{store: p, layout: layout, worker: w}, true, err
+	case *time.Duration:
+		return b.order(durationEncoder{p}, 8, 1, false), true, nil
+	case *big.Int:
+		layout := new(bigIntLayout)
+		w, err := b.makeEncoder(reflect.ValueOf(layout))
+		return bigIntEncoder{store: p, layout: layout, worker: w}, true, err
+	case *big.Float:
+		layout := new([]byte)
+		w, err := b.makeEncoder(reflect.ValueOf(layout))
+		return bigFloatEncoder{store: p, layout: layout, worker: w}, true, err
+	case *big.Rat:
+		layout := new(bigRatLayout)
+		w, err := b.makeEncoder(reflect.ValueOf(layout))
+		return bigRatEncoder{store: p, layout: layout, worker: w}, true, err
+	}
+	return nil, false, nil
+}
+
+// kindPtr converts a pointer to a variable of a named type
+// to a pointer to the basic type of its kind,
+// given by a sample value (eg. *time.Month to *int).
+func kindPtr(v reflect.Value, sample interface{}) interface{} {
+	return v.Convert(reflect.PtrTo(reflect.TypeOf(sample))).Interface()
+}
+
+// order adapts an Encoder of numbers to the ordered format
+// (see Ordered Data), if it's selected.
+// Serialized data of the Encoder is composed of
+// count numbers of width bytes;
+// parameter float tells if they are floating point numbers.
+func (b *builder) order(e Encoder, width, count int, float bool) Encoder {
+	if !b.options.Ordered {
+		return e
+	}
+	return orderedEncoder{worker: e, width: width, count: count, float: float}
+}
+
+// prefix adapts an Encoder of composite values
+// to length-prefixed composites (see Length-Prefixed Composites),
+// if they are selected.
+func (b *builder) prefix(e Encoder) Encoder {
+	if !b.options.LengthPrefixed {
+		return e
 	}
+	return prefixedEncoder{worker: e, varint: b.options.VarintLengths}
 }
 
 // readEncoder tells an Encoder to marshal
@@ -18,12 +18,20 @@ package raw_test
 
 import (
 	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"github.com/coolparadox/go/encoding/raw"
+	"math"
+	"math/big"
 	"math/rand"
 	"reflect"
 	"strconv"
+	"sync"
 	"testing"
+	"testing/iotest"
 	"time"
 )
 
@@ -118,7 +126,7 @@ func TestUint8Encoder(t *testing.T) {
 	backupData := myData
 	backupN := n
 	myData = 0
-	n, err = encoder.Write(b)
+	n, err = encoder.Write(b[:n])
 	if err != nil {
 		t.Fatalf("Write() failed: %s", err)
 	}
@@ -159,7 +167,7 @@ func TestInt8Encoder(t *testing.T) {
 	backupData := myData
 	backupN := n
 	myData = 0
-	n, err = encoder.Write(b)
+	n, err = encoder.Write(b[:n])
 	if err != nil {
 		t.Fatalf("Write() failed: %s", err)
 	}
@@ -200,7 +208,7 @@ func TestUint16Encoder(t *testing.T) {
 	backupData := myData
 	backupN := n
 	myData = 0
-	n, err = encoder.Write(b)
+	n, err = encoder.Write(b[:n])
 	if err != nil {
 		t.Fatalf("Write() failed: %s", err)
 	}
@@ -241,7 +249,7 @@ func TestInt16Encoder(t *testing.T) {
 	backupData := myData
 	backupN := n
 	myData = 0
-	n, err = encoder.Write(b)
+	n, err = encoder.Write(b[:n])
 	if err != nil {
 		t.Fatalf("Write() failed: %s", err)
 	}
@@ -282,7 +290,7 @@ func TestUint32Encoder(t *testing.T) {
 	backupData := myData
 	backupN := n
 	myData = 0
-	n, err = encoder.Write(b)
+	n, err = encoder.Write(b[:n])
 	if err != nil {
 		t.Fatalf("Write() failed: %s", err)
 	}
@@ -323,7 +331,7 @@ func TestInt32Encoder(t *testing.T) {
 	backupData := myData
 	backupN := n
 	myData = 0
-	n, err = encoder.Write(b)
+	n, err = encoder.Write(b[:n])
 	if err != nil {
 		t.Fatalf("Write() failed: %s", err)
 	}
@@ -364,7 +372,7 @@ func TestUint64Encoder(t *testing.T) {
 	backupData := myData
 	backupN := n
 	myData = 0
-	n, err = encoder.Write(b)
+	n, err = encoder.Write(b[:n])
 	if err != nil {
 		t.Fatalf("Write() failed: %s", err)
 	}
@@ -405,7 +413,7 @@ func TestInt64Encoder(t *testing.T) {
 	backupData := myData
 	backupN := n
 	myData = 0
-	n, err = encoder.Write(b)
+	n, err = encoder.Write(b[:n])
 	if err != nil {
 		t.Fatalf("Write() failed: %s", err)
 	}
@@ -907,3 +915,2415 @@ func TestSliceSliceStructEncoder(t *testing.T) {
 		t.Fatalf("marshal / unmarshal mismatch: expected %v, received %v", myData2, myData)
 	}
 }
+
+func TestSelfDescribing(t *testing.T) {
+	var myData []string
+	encoder, err := raw.NewWithOptions(&myData, raw.Options{SelfDescribing: true})
+	if err != nil {
+		t.Fatalf("NewWithOptions() failed: %s", err)
+	}
+	myData = []string{"hello", "world"}
+	var b bytes.Buffer
+	_, err = encoder.WriteTo(&b)
+	if err != nil {
+		t.Fatalf("WriteTo() failed: %s", err)
+	}
+	t.Logf("marshal %v --> %v", myData, b.Bytes())
+	serial := b.Bytes()
+	var myData2 []string
+	encoder2, err := raw.NewWithOptions(&myData2, raw.Options{SelfDescribing: true})
+	if err != nil {
+		t.Fatalf("NewWithOptions() failed: %s", err)
+	}
+	_, err = encoder2.ReadFrom(bytes.NewReader(serial))
+	if err != nil {
+		t.Fatalf("ReadFrom() failed: %s", err)
+	}
+	if !reflect.DeepEqual(myData, myData2) {
+		t.Fatalf("marshal / unmarshal mismatch: expected %v, received %v", myData, myData2)
+	}
+	var otherData []int32
+	encoder3, err := raw.NewWithOptions(&otherData, raw.Options{SelfDescribing: true})
+	if err != nil {
+		t.Fatalf("NewWithOptions() failed: %s", err)
+	}
+	_, err = encoder3.ReadFrom(bytes.NewReader(serial))
+	if !errors.Is(err, raw.SignatureMismatchError) {
+		t.Fatalf("ReadFrom() error mismatch: expected SignatureMismatchError, received %v", err)
+	}
+	t.Logf("ReadFrom() with wrong type: %s", err)
+	encoder4, err := raw.New(&myData2)
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	b.Reset()
+	encoder4.WriteTo(&b)
+	_, err = encoder2.ReadFrom(&b)
+	if !errors.Is(err, raw.BadHeaderError) {
+		t.Fatalf("ReadFrom() error mismatch: expected BadHeaderError, received %v", err)
+	}
+}
+
+func TestTaggedStructEncoder(t *testing.T) {
+	type MyStructV1 struct {
+		A int64  `raw:"1"`
+		B string `raw:"2"`
+		C []bool `raw:"3"`
+	}
+	type MyStructV2 struct {
+		D float32 `raw:"4"`
+		B string  `raw:"2"`
+		A int64   `raw:"1"`
+	}
+	var myData MyStructV1
+	expected_signature := "struct { 1:int64; 2:string; 3:[]bool }"
+	encoder, err := raw.New(&myData)
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	signature := encoder.Signature()
+	if signature != expected_signature {
+		t.Fatalf("signature mismatch: expected '%s', received '%s'", expected_signature, signature)
+	}
+	myData.A = random_int64()
+	myData.B = strconv.Itoa(int(random_uint32()))
+	myData.C = []bool{true, false, true}
+	var b bytes.Buffer
+	_, err = encoder.WriteTo(&b)
+	if err != nil {
+		t.Fatalf("WriteTo() failed: %s", err)
+	}
+	t.Logf("marshal %v --> %v", myData, b.Bytes())
+	var myData2 MyStructV2
+	myData2.D = random_float32()
+	encoder2, err := raw.New(&myData2)
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	n, err := encoder2.ReadFrom(&b)
+	if err != nil {
+		t.Fatalf("ReadFrom() failed: %s", err)
+	}
+	t.Logf("unmarshal %v bytes --> %v", n, myData2)
+	expected := MyStructV2{A: myData.A, B: myData.B}
+	if !reflect.DeepEqual(myData2, expected) {
+		t.Fatalf("marshal / unmarshal mismatch: expected %v, received %v", expected, myData2)
+	}
+}
+
+func TestTaggedStructEncoderBadTags(t *testing.T) {
+	var myData struct {
+		A int64 `raw:"1"`
+		B string
+	}
+	_, err := raw.New(&myData)
+	if err == nil {
+		t.Fatalf("New() accepted struct with partial field IDs")
+	}
+	var myData2 struct {
+		A int64  `raw:"1"`
+		B string `raw:"1"`
+	}
+	_, err = raw.New(&myData2)
+	if err == nil {
+		t.Fatalf("New() accepted struct with duplicate field IDs")
+	}
+}
+
+func TestIntEncoder(t *testing.T) {
+	var myData struct {
+		I int
+		U uint
+		P uintptr
+	}
+	expected_signature := "struct { int; uint; uintptr }"
+	encoder, err := raw.New(&myData)
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	signature := encoder.Signature()
+	if signature != expected_signature {
+		t.Fatalf("signature mismatch: expected '%s', received '%s'", expected_signature, signature)
+	}
+	myData.I = int(random_int32())
+	myData.U = uint(random_uint32())
+	myData.P = uintptr(random_uint32())
+	var b bytes.Buffer
+	n, err := encoder.WriteTo(&b)
+	if err != nil {
+		t.Fatalf("WriteTo() failed: %s", err)
+	}
+	if n != 24 {
+		t.Fatalf("marshal length mismatch: expected 24, received %v", n)
+	}
+	t.Logf("marshal %v --> %v", myData, b.Bytes())
+	myData2 := myData
+	myData.I, myData.U, myData.P = 0, 0, 0
+	_, err = encoder.ReadFrom(&b)
+	if err != nil {
+		t.Fatalf("ReadFrom() failed: %s", err)
+	}
+	if !reflect.DeepEqual(myData, myData2) {
+		t.Fatalf("marshal / unmarshal mismatch: expected %v, received %v", myData2, myData)
+	}
+}
+
+type testEvent interface {
+	When() int64
+}
+
+type testClick struct {
+	At   int64
+	X, Y int32
+}
+
+func (c testClick) When() int64 { return c.At }
+
+type testKey struct {
+	At  int64
+	Key string
+}
+
+func (k *testKey) When() int64 { return k.At }
+
+type testUnregistered struct{ At int64 }
+
+func (u testUnregistered) When() int64 { return u.At }
+
+func TestInterfaceEncoder(t *testing.T) {
+	var err error
+	err = raw.Register("click", testClick{})
+	if err != nil {
+		t.Fatalf("Register() failed: %s", err)
+	}
+	err = raw.Register("key", &testKey{})
+	if err != nil {
+		t.Fatalf("Register() failed: %s", err)
+	}
+	err = raw.Register("click", testUnregistered{})
+	if err == nil {
+		t.Fatalf("Register() accepted a name twice")
+	}
+	var myData struct {
+		Events []testEvent
+	}
+	expected_signature := "struct { []interface }"
+	encoder, err := raw.New(&myData)
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	signature := encoder.Signature()
+	if signature != expected_signature {
+		t.Fatalf("signature mismatch: expected '%s', received '%s'", expected_signature, signature)
+	}
+	myData.Events = []testEvent{
+		testClick{At: random_int64(), X: random_int32(), Y: random_int32()},
+		nil,
+		&testKey{At: random_int64(), Key: "q"},
+	}
+	var b bytes.Buffer
+	_, err = encoder.WriteTo(&b)
+	if err != nil {
+		t.Fatalf("WriteTo() failed: %s", err)
+	}
+	t.Logf("marshal %v --> %v", myData, b.Bytes())
+	myData2 := myData
+	myData.Events = nil
+	_, err = encoder.ReadFrom(&b)
+	if err != nil {
+		t.Fatalf("ReadFrom() failed: %s", err)
+	}
+	if !reflect.DeepEqual(myData, myData2) {
+		t.Fatalf("marshal / unmarshal mismatch: expected %v, received %v", myData2, myData)
+	}
+	myData.Events[1] = testUnregistered{}
+	_, err = encoder.WriteTo(&b)
+	if !errors.Is(err, raw.UnregisteredTypeError) {
+		t.Fatalf("WriteTo() error mismatch: expected UnregisteredTypeError, received %v", err)
+	}
+	expected_error := ".Events[1]: type not registered: raw_test.testUnregistered"
+	if err.Error() != expected_error {
+		t.Fatalf("WriteTo() error mismatch: expected '%s', received '%s'", expected_error, err)
+	}
+}
+
+type testScroll struct {
+	At     int64
+	offset int32
+}
+
+func (s testScroll) When() int64 { return s.At }
+
+func TestRegisterUnexported(t *testing.T) {
+	err := raw.Register("scroll", testScroll{})
+	if err != nil {
+		t.Fatalf("Register() failed: %s", err)
+	}
+	myData := []testEvent{testScroll{At: random_int64(), offset: random_int32()}}
+	encoder, err := raw.NewWithOptions(&myData, raw.Options{IgnoreUnexported: true})
+	if err != nil {
+		t.Fatalf("NewWithOptions() failed: %s", err)
+	}
+	var b bytes.Buffer
+	_, err = encoder.WriteTo(&b)
+	if err != nil {
+		t.Fatalf("WriteTo() failed: %s", err)
+	}
+	expected := []testEvent{testScroll{At: myData[0].When()}}
+	myData = nil
+	_, err = encoder.ReadFrom(&b)
+	if err != nil {
+		t.Fatalf("ReadFrom() failed: %s", err)
+	}
+	if !reflect.DeepEqual(myData, expected) {
+		t.Fatalf("marshal / unmarshal mismatch: expected %v, received %v", expected, myData)
+	}
+	// Without IgnoreUnexported the registered type is not supported.
+	encoder, err = raw.New(&myData)
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	_, err = encoder.WriteTo(&b)
+	if err == nil {
+		t.Fatalf("WriteTo() succeeded with unexported fields")
+	}
+}
+
+type testNode struct {
+	Value    int64
+	Parent   *testNode
+	Children []*testNode
+}
+
+func TestRecursiveType(t *testing.T) {
+	type List struct {
+		Value int32
+		Next  *List
+	}
+	var myData List
+	expected_signature := "struct { int32; *^2 }"
+	encoder, err := raw.New(&myData)
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	signature := encoder.Signature()
+	if signature != expected_signature {
+		t.Fatalf("signature mismatch: expected '%s', received '%s'", expected_signature, signature)
+	}
+	myData = List{1, &List{2, &List{3, nil}}}
+	var b bytes.Buffer
+	_, err = encoder.WriteTo(&b)
+	if err != nil {
+		t.Fatalf("WriteTo() failed: %s", err)
+	}
+	t.Logf("marshal %v --> %v", myData, b.Bytes())
+	myData2 := myData
+	myData = List{}
+	_, err = encoder.ReadFrom(&b)
+	if err != nil {
+		t.Fatalf("ReadFrom() failed: %s", err)
+	}
+	if !reflect.DeepEqual(myData, myData2) {
+		t.Fatalf("marshal / unmarshal mismatch: expected %v, received %v", myData2, myData)
+	}
+}
+
+func TestTrackReferences(t *testing.T) {
+	var myData struct {
+		Root   *testNode
+		Shared *testNode
+	}
+	expected_signature := "struct { *struct { int64; ^2; []^3 }; *struct { int64; ^2; []^3 } }"
+	encoder, err := raw.NewWithOptions(&myData, raw.Options{TrackReferences: true})
+	if err != nil {
+		t.Fatalf("NewWithOptions() failed: %s", err)
+	}
+	signature := encoder.Signature()
+	if signature != expected_signature {
+		t.Fatalf("signature mismatch: expected '%s', received '%s'", expected_signature, signature)
+	}
+	root := &testNode{Value: random_int64()}
+	for i := 0; i < 3; i++ {
+		child := &testNode{Value: random_int64(), Parent: root}
+		root.Children = append(root.Children, child)
+	}
+	myData.Root = root
+	myData.Shared = root.Children[1]
+	var b bytes.Buffer
+	_, err = encoder.WriteTo(&b)
+	if err != nil {
+		t.Fatalf("WriteTo() failed: %s", err)
+	}
+	t.Logf("marshal --> %v", b.Bytes())
+	myData.Root = nil
+	myData.Shared = nil
+	_, err = encoder.ReadFrom(&b)
+	if err != nil {
+		t.Fatalf("ReadFrom() failed: %s", err)
+	}
+	if myData.Root == nil || myData.Root.Value != root.Value || len(myData.Root.Children) != 3 {
+		t.Fatalf("marshal / unmarshal mismatch: expected %v, received %v", root, myData.Root)
+	}
+	for i, child := range myData.Root.Children {
+		if child.Value != root.Children[i].Value {
+			t.Fatalf("child %v value mismatch: expected %v, received %v", i, root.Children[i].Value, child.Value)
+		}
+		if child.Parent != myData.Root {
+			t.Fatalf("child %v does not point back to its parent", i)
+		}
+	}
+	if myData.Shared != myData.Root.Children[1] {
+		t.Fatalf("shared pointer recovered as a copy")
+	}
+}
+
+func TestOrdered(t *testing.T) {
+	type MyStruct struct {
+		A int16
+		B float64
+		C string
+		D []int32
+		E [2]float32
+	}
+	compare := func(x, y MyStruct) int {
+		switch {
+		case x.A != y.A:
+			return map[bool]int{true: -1, false: 1}[x.A < y.A]
+		case x.B != y.B:
+			return map[bool]int{true: -1, false: 1}[x.B < y.B]
+		case x.C != y.C:
+			return map[bool]int{true: -1, false: 1}[x.C < y.C]
+		}
+		for i := 0; i < len(x.D) && i < len(y.D); i++ {
+			if x.D[i] != y.D[i] {
+				return map[bool]int{true: -1, false: 1}[x.D[i] < y.D[i]]
+			}
+		}
+		if len(x.D) != len(y.D) {
+			return map[bool]int{true: -1, false: 1}[len(x.D) < len(y.D)]
+		}
+		for i := 0; i < len(x.E); i++ {
+			if x.E[i] != y.E[i] {
+				return map[bool]int{true: -1, false: 1}[x.E[i] < y.E[i]]
+			}
+		}
+		return 0
+	}
+	var myData MyStruct
+	encoder, err := raw.NewWithOptions(&myData, raw.Options{Ordered: true})
+	if err != nil {
+		t.Fatalf("NewWithOptions() failed: %s", err)
+	}
+	strings := []string{"", "\x00", "\x00\x00", "\x00a", "a", "a\x00", "ab", "b"}
+	values := make([]MyStruct, 200)
+	serials := make([][]byte, len(values))
+	for i := range values {
+		values[i].A = int16(random_int8() % 3)
+		values[i].B = float64(random_int8()%3) / 2
+		values[i].C = strings[random_uint8()%uint8(len(strings))]
+		values[i].D = make([]int32, random_uint8()%3)
+		for j := range values[i].D {
+			values[i].D[j] = random_int32() % 3
+		}
+		values[i].E[0] = random_float32()
+		values[i].E[1] = random_float32()
+		myData = values[i]
+		var b bytes.Buffer
+		_, err = encoder.WriteTo(&b)
+		if err != nil {
+			t.Fatalf("WriteTo() failed: %s", err)
+		}
+		serials[i] = b.Bytes()
+		myData = MyStruct{}
+		_, err = encoder.ReadFrom(&b)
+		if err != nil {
+			t.Fatalf("ReadFrom() failed: %s", err)
+		}
+		if compare(myData, values[i]) != 0 || len(myData.D) != len(values[i].D) {
+			t.Fatalf("marshal / unmarshal mismatch: expected %v, received %v", values[i], myData)
+		}
+	}
+	for i := range values {
+		for j := range values {
+			expected := compare(values[i], values[j])
+			received := bytes.Compare(serials[i], serials[j])
+			if expected != received {
+				t.Fatalf("ordering mismatch between %v and %v: expected %v, received %v (%v, %v)", values[i], values[j], expected, received, serials[i], serials[j])
+			}
+		}
+	}
+	var otherData map[string]int32
+	_, err = raw.NewWithOptions(&otherData, raw.Options{Ordered: true})
+	if err == nil {
+		t.Fatalf("NewWithOptions() accepted a map in ordered format")
+	}
+}
+
+type testMoney struct {
+	cents int64
+}
+
+func (m testMoney) MarshalRaw() ([]byte, error) {
+	return []byte(strconv.FormatInt(m.cents, 10)), nil
+}
+
+func (m *testMoney) UnmarshalRaw(b []byte) error {
+	var err error
+	m.cents, err = strconv.ParseInt(string(b), 10, 64)
+	return err
+}
+
+type testID struct {
+	id uint32
+}
+
+func (i *testID) MarshalBinary() ([]byte, error) {
+	return []byte{byte(i.id), byte(i.id >> 8), byte(i.id >> 16), byte(i.id >> 24)}, nil
+}
+
+func (i *testID) UnmarshalBinary(b []byte) error {
+	if len(b) != 4 {
+		return fmt.Errorf("bad ID length %v", len(b))
+	}
+	i.id = uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+	return nil
+}
+
+func TestMarshalerEncoder(t *testing.T) {
+	var myData struct {
+		Price testMoney
+		IDs   []testID
+		Owner *testID
+	}
+	expected_signature := "struct { raw(raw_test.testMoney); []binary(raw_test.testID); *binary(raw_test.testID) }"
+	encoder, err := raw.New(&myData)
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	signature := encoder.Signature()
+	if signature != expected_signature {
+		t.Fatalf("signature mismatch: expected '%s', received '%s'", expected_signature, signature)
+	}
+	myData.Price = testMoney{random_int64()}
+	myData.IDs = []testID{{random_uint32()}, {random_uint32()}}
+	myData.Owner = &testID{random_uint32()}
+	var b bytes.Buffer
+	_, err = encoder.WriteTo(&b)
+	if err != nil {
+		t.Fatalf("WriteTo() failed: %s", err)
+	}
+	t.Logf("marshal %v --> %v", myData, b.Bytes())
+	myData2 := myData
+	myData.Price = testMoney{}
+	myData.IDs = nil
+	myData.Owner = nil
+	_, err = encoder.ReadFrom(&b)
+	if err != nil {
+		t.Fatalf("ReadFrom() failed: %s", err)
+	}
+	if !reflect.DeepEqual(myData, myData2) {
+		t.Fatalf("marshal / unmarshal mismatch: expected %v, received %v", myData2, myData)
+	}
+}
+
+type testStamped struct {
+	time.Time
+	Name string
+}
+
+type testOverride struct {
+	time.Time
+}
+
+func (o testOverride) MarshalBinary() ([]byte, error) {
+	return []byte(strconv.FormatInt(o.Unix(), 10)), nil
+}
+
+func (o *testOverride) UnmarshalBinary(b []byte) error {
+	sec, err := strconv.ParseInt(string(b), 10, 64)
+	o.Time = time.Unix(sec, 0)
+	return err
+}
+
+type testNamedTime struct {
+	At time.Time
+}
+
+func (o testNamedTime) MarshalBinary() ([]byte, error) {
+	return []byte(strconv.FormatInt(o.At.Unix(), 10)), nil
+}
+
+func (o *testNamedTime) UnmarshalBinary(b []byte) error {
+	sec, err := strconv.ParseInt(string(b), 10, 64)
+	o.At = time.Unix(sec, 0)
+	return err
+}
+
+func TestPromotedMarshaler(t *testing.T) {
+	// Methods promoted from embedded fields do not take over.
+	myData := testStamped{Time: time.Unix(random_int64()%(1<<40), 0).UTC(), Name: "name"}
+	expected_signature := "struct { time.Time; string }"
+	encoder, err := raw.New(&myData)
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	if encoder.Signature() != expected_signature {
+		t.Fatalf("signature mismatch: expected '%s', received '%s'", expected_signature, encoder.Signature())
+	}
+	var b bytes.Buffer
+	_, err = encoder.WriteTo(&b)
+	if err != nil {
+		t.Fatalf("WriteTo() failed: %s", err)
+	}
+	myData2 := myData
+	myData = testStamped{}
+	_, err = encoder.ReadFrom(&b)
+	if err != nil {
+		t.Fatalf("ReadFrom() failed: %s", err)
+	}
+	if !myData.Equal(myData2.Time) || myData.Name != myData2.Name {
+		t.Fatalf("marshal / unmarshal mismatch: expected %v, received %v", myData2, myData)
+	}
+	// Methods declared by the type itself cannot be told from promoted ones.
+	var override testOverride
+	encoder, err = raw.New(&override)
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	expected_signature = "struct { time.Time }"
+	if encoder.Signature() != expected_signature {
+		t.Fatalf("signature mismatch: expected '%s', received '%s'", expected_signature, encoder.Signature())
+	}
+	// Methods of types with no embedded fields take over.
+	var named testNamedTime
+	encoder, err = raw.New(&named)
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	expected_signature = "binary(raw_test.testNamedTime)"
+	if encoder.Signature() != expected_signature {
+		t.Fatalf("signature mismatch: expected '%s', received '%s'", expected_signature, encoder.Signature())
+	}
+}
+
+func TestBuiltinEncoders(t *testing.T) {
+	var myData struct {
+		When    []time.Time
+		Timeout time.Duration
+		Count   *big.Int
+		Ratio   big.Rat
+		Amount  big.Float
+	}
+	expected_signature := "struct { []time.Time; time.Duration; *big.Int; big.Rat; big.Float }"
+	encoder, err := raw.New(&myData)
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	signature := encoder.Signature()
+	if signature != expected_signature {
+		t.Fatalf("signature mismatch: expected '%s', received '%s'", expected_signature, signature)
+	}
+	myData.When = []time.Time{
+		time.Now(),
+		time.Date(2016, time.October, 12, 18, 0, 0, 123, time.UTC),
+		time.Date(2016, time.October, 12, 18, 0, 0, 0, time.FixedZone("XYZ", -3*3600)),
+	}
+	myData.Timeout = time.Duration(random_int64())
+	myData.Count, _ = new(big.Int).SetString("-123456789012345678901234567890", 10)
+	myData.Ratio.SetFrac64(random_int64(), int64(random_uint32())+1)
+	myData.Amount.SetPrec(200).SetFloat64(random_float64())
+	myData.Amount.Quo(&myData.Amount, big.NewFloat(3))
+	var b bytes.Buffer
+	_, err = encoder.WriteTo(&b)
+	if err != nil {
+		t.Fatalf("WriteTo() failed: %s", err)
+	}
+	t.Logf("marshal %v --> %v", myData, b.Bytes())
+	myData2 := myData
+	myData.When = nil
+	myData.Timeout = 0
+	myData.Count = nil
+	myData.Ratio = big.Rat{}
+	myData.Amount = big.Float{}
+	_, err = encoder.ReadFrom(&b)
+	if err != nil {
+		t.Fatalf("ReadFrom() failed: %s", err)
+	}
+	t.Logf("unmarshal --> %v", myData)
+	if len(myData.When) != len(myData2.When) {
+		t.Fatalf("marshal / unmarshal mismatch: expected %v, received %v", myData2.When, myData.When)
+	}
+	for i := range myData.When {
+		expected := myData2.When[i]
+		received := myData.When[i]
+		if !received.Equal(expected) || received.Location().String() != expected.Location().String() || received.Format(time.RFC3339Nano) != expected.Format(time.RFC3339Nano) {
+			t.Fatalf("marshal / unmarshal mismatch: expected %v, received %v", expected, received)
+		}
+	}
+	if myData.Timeout != myData2.Timeout {
+		t.Fatalf("marshal / unmarshal mismatch: expected %v, received %v", myData2.Timeout, myData.Timeout)
+	}
+	if myData.Count.Cmp(myData2.Count) != 0 {
+		t.Fatalf("marshal / unmarshal mismatch: expected %v, received %v", myData2.Count, myData.Count)
+	}
+	if myData.Ratio.Cmp(&myData2.Ratio) != 0 {
+		t.Fatalf("marshal / unmarshal mismatch: expected %v, received %v", &myData2.Ratio, &myData.Ratio)
+	}
+	if myData.Amount.Cmp(&myData2.Amount) != 0 || myData.Amount.Prec() != myData2.Amount.Prec() {
+		t.Fatalf("marshal / unmarshal mismatch: expected %v, received %v", &myData2.Amount, &myData.Amount)
+	}
+}
+
+func TestStreaming(t *testing.T) {
+	var myData []string
+	encoder, err := raw.New(&myData)
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	m := int(random_uint8()%100 + 100)
+	for i := 0; i < m; i++ {
+		myData = append(myData, strconv.Itoa(int(random_uint32())))
+	}
+	var expected bytes.Buffer
+	_, err = encoder.WriteTo(&expected)
+	if err != nil {
+		t.Fatalf("WriteTo() failed: %s", err)
+	}
+	for i := 0; i < 2; i++ {
+		var b bytes.Buffer
+		chunk := make([]byte, 7)
+		for {
+			n, err := encoder.Read(chunk)
+			b.Write(chunk[:n])
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("Read() failed: %s", err)
+			}
+		}
+		if !bytes.Equal(b.Bytes(), expected.Bytes()) {
+			t.Fatalf("Read() mismatch: expected %v, received %v", expected.Bytes(), b.Bytes())
+		}
+	}
+	var myData2 []string
+	encoder2, err := raw.New(&myData2)
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	// Hide ReadFrom from io.Copy, so data reaches Write in small chunks.
+	_, err = io.Copy(struct{ io.Writer }{encoder2}, iotest.HalfReader(bytes.NewReader(expected.Bytes())))
+	if err != nil {
+		t.Fatalf("Write() failed: %s", err)
+	}
+	if !reflect.DeepEqual(myData, myData2) {
+		t.Fatalf("marshal / unmarshal mismatch: expected %v, received %v", myData, myData2)
+	}
+	// Bytes past the end of the sequence
+	half := expected.Len() / 2
+	_, err = encoder2.Write(expected.Bytes()[:half])
+	if err != nil {
+		t.Fatalf("Write() failed: %s", err)
+	}
+	n, err := encoder2.Write(append(expected.Bytes()[half:], 0x01, 0x02))
+	if !errors.Is(err, raw.TrailingDataError) || n != expected.Len()-half {
+		t.Fatalf("Write() of trailing data: expected %v bytes and TrailingDataError, received %v bytes and %v", expected.Len()-half, n, err)
+	}
+	if !reflect.DeepEqual(myData, myData2) {
+		t.Fatalf("marshal / unmarshal mismatch: expected %v, received %v", myData, myData2)
+	}
+	// An incomplete sequence is abandoned by ReadFrom.
+	_, err = encoder2.Write(expected.Bytes()[:half])
+	if err != nil {
+		t.Fatalf("Write() failed: %s", err)
+	}
+	myData2 = nil
+	_, err = encoder2.ReadFrom(bytes.NewReader(expected.Bytes()))
+	if err != nil {
+		t.Fatalf("ReadFrom() failed: %s", err)
+	}
+	if !reflect.DeepEqual(myData, myData2) {
+		t.Fatalf("marshal / unmarshal mismatch: expected %v, received %v", myData, myData2)
+	}
+}
+
+func TestNamedKinds(t *testing.T) {
+	type Celsius float32
+	type Name string
+	var myData struct {
+		Month time.Month
+		Temp  Celsius
+		Names []Name
+	}
+	expected_signature := "struct { int; float32; []string }"
+	encoder, err := raw.New(&myData)
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	signature := encoder.Signature()
+	if signature != expected_signature {
+		t.Fatalf("signature mismatch: expected '%s', received '%s'", expected_signature, signature)
+	}
+	myData.Month = time.October
+	myData.Temp = Celsius(random_float32())
+	myData.Names = []Name{"hello", "world"}
+	var b bytes.Buffer
+	_, err = encoder.WriteTo(&b)
+	if err != nil {
+		t.Fatalf("WriteTo() failed: %s", err)
+	}
+	myData2 := myData
+	myData.Month = 0
+	myData.Temp = 0
+	myData.Names = nil
+	_, err = encoder.ReadFrom(&b)
+	if err != nil {
+		t.Fatalf("ReadFrom() failed: %s", err)
+	}
+	if !reflect.DeepEqual(myData, myData2) {
+		t.Fatalf("marshal / unmarshal mismatch: expected %v, received %v", myData2, myData)
+	}
+}
+
+type testLimited struct {
+	Names []string
+	Tags  map[string]string
+}
+
+func TestLimits(t *testing.T) {
+	// A length prefix of 2^32-2 elements with no data following.
+	hostile := []byte{0xFE, 0xFF, 0xFF, 0xFF}
+	var numbers []uint64
+	e, err := raw.New(&numbers)
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	_, err = e.ReadFrom(bytes.NewReader(hostile))
+	if err == nil {
+		t.Fatalf("ReadFrom() of hostile slice succeeded")
+	}
+	var text string
+	e, err = raw.New(&text)
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	_, err = e.ReadFrom(bytes.NewReader(hostile))
+	if err == nil {
+		t.Fatalf("ReadFrom() of hostile string succeeded")
+	}
+	myData := testLimited{
+		Names: []string{"gandalf", "saruman", "radagast"},
+		Tags:  map[string]string{"color": "grey"},
+	}
+	var b bytes.Buffer
+	e, err = raw.New(&myData)
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	_, err = e.WriteTo(&b)
+	if err != nil {
+		t.Fatalf("WriteTo() failed: %s", err)
+	}
+	for _, tc := range []struct {
+		limits raw.Limits
+		limit  string
+	}{
+		{raw.Limits{MaxElements: 3, MaxStringLength: 8, MaxBytes: int64(b.Len())}, ""},
+		{raw.Limits{MaxElements: 2}, "MaxElements"},
+		{raw.Limits{MaxStringLength: 7}, "MaxStringLength"},
+		{raw.Limits{MaxBytes: int64(b.Len() - 1)}, "MaxBytes"},
+	} {
+		var myData2 testLimited
+		e2, err := raw.NewWithOptions(&myData2, raw.Options{Limits: tc.limits})
+		if err != nil {
+			t.Fatalf("NewWithOptions() failed: %s", err)
+		}
+		_, err = e2.ReadFrom(bytes.NewReader(b.Bytes()))
+		if tc.limit == "" {
+			if err != nil {
+				t.Fatalf("ReadFrom() with %+v failed: %s", tc.limits, err)
+			}
+			if !reflect.DeepEqual(myData2, myData) {
+				t.Fatalf("ReadFrom() mismatch: expected %v, received %v", myData, myData2)
+			}
+			continue
+		}
+		var le *raw.LimitError
+		if !errors.As(err, &le) || le.Limit != tc.limit {
+			t.Fatalf("ReadFrom() with %+v: expected error of limit %s, received %v", tc.limits, tc.limit, err)
+		}
+		_, err = e2.Write(b.Bytes())
+		if !errors.As(err, &le) || le.Limit != tc.limit {
+			t.Fatalf("Write() with %+v: expected error of limit %s, received %v", tc.limits, tc.limit, err)
+		}
+	}
+	var name string
+	e, err = raw.NewWithOptions(&name, raw.Options{Ordered: true, Limits: raw.Limits{MaxStringLength: 3}})
+	if err != nil {
+		t.Fatalf("NewWithOptions() failed: %s", err)
+	}
+	_, err = e.ReadFrom(bytes.NewReader([]byte{'f', 'r', 'o', 'd', 'o', 0x00, 0x01}))
+	var le *raw.LimitError
+	if !errors.As(err, &le) || le.Limit != "MaxStringLength" {
+		t.Fatalf("ReadFrom() of ordered string: expected error of limit MaxStringLength, received %v", err)
+	}
+}
+
+func TestParseSignature(t *testing.T) {
+	var myData struct {
+		A [3]map[string]*float64
+		B testNode
+		C testMoney
+		D *testID
+		E time.Time
+		F testEvent
+		G struct {
+			X int    `raw:"7"`
+			Y []uint `raw:"2"`
+		}
+		H struct{}
+	}
+	e, err := raw.New(&myData)
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	s, err := raw.ParseSignature(e.Signature())
+	if err != nil {
+		t.Fatalf("ParseSignature() failed: %s", err)
+	}
+	if s.String() != e.Signature() {
+		t.Fatalf("String() mismatch: expected '%s', received '%s'", e.Signature(), s.String())
+	}
+	if s.Kind != raw.StructKind || len(s.Fields) != 8 {
+		t.Fatalf("ParseSignature() mismatch: expected struct of 8 fields, received %+v", s)
+	}
+	a := s.Fields[0].Type
+	if a.Kind != raw.ArrayKind || a.Len != 3 || a.Elem.Kind != raw.MapKind || a.Elem.Key.Name != "string" || a.Elem.Elem.Elem.Name != "float64" {
+		t.Fatalf("ParseSignature() mismatch of field A: received '%s'", a)
+	}
+	parent := s.Fields[1].Type.Fields[1].Type
+	if parent.Kind != raw.PointerKind || parent.Elem.Kind != raw.RecursiveKind || parent.Elem.Up != 2 {
+		t.Fatalf("ParseSignature() mismatch of field B.Parent: received '%s'", parent)
+	}
+	if c := s.Fields[2].Type; c.Kind != raw.MarshalerKind || c.Name != "raw_test.testMoney" {
+		t.Fatalf("ParseSignature() mismatch of field C: received '%s'", c)
+	}
+	if d := s.Fields[3].Type.Elem; d.Kind != raw.BinaryMarshalerKind || d.Name != "raw_test.testID" {
+		t.Fatalf("ParseSignature() mismatch of field D: received '%s'", d)
+	}
+	if g := s.Fields[6].Type; !g.Tagged || g.Fields[0].ID != 7 || g.Fields[1].ID != 2 {
+		t.Fatalf("ParseSignature() mismatch of field G: received '%s'", g)
+	}
+	for _, bad := range []string{
+		"",
+		"int65",
+		"[]",
+		"[x]int8",
+		"map[string]",
+		"struct { int8",
+		"struct { 1:int8; string }",
+		"struct { 1:int8; 1:string }",
+		"struct { 0:int8 }",
+		"*^2",
+		"raw(",
+		"int8 int8",
+	} {
+		_, err = raw.ParseSignature(bad)
+		if err == nil {
+			t.Fatalf("ParseSignature() of '%s' succeeded", bad)
+		}
+	}
+}
+
+func TestCompatible(t *testing.T) {
+	for _, tc := range []struct {
+		written, reading string
+		compatible       bool
+	}{
+		{"struct { []int32; map[string]*float64 }", "struct { []int32; map[string]*float64 }", true},
+		{"struct{[]int32;map[string]*float64}", "struct { []int32; map[string]*float64 }", true},
+		{"[]int", "[]int64", true},
+		{"time.Duration", "int64", true},
+		{"uintptr", "uint", true},
+		{"[]int32", "[]int64", false},
+		{"[2]bool", "[3]bool", false},
+		{"struct { int8 }", "struct { int8; int8 }", false},
+		{"struct { 1:int8; 2:string }", "struct { 3:bool; 1:int8 }", true},
+		{"struct { 1:int8; 2:string }", "struct { 2:bool }", false},
+		{"struct { 1:int8 }", "struct { int8 }", false},
+		{"struct { int64; *^1 }", "struct { int; *^1 }", true},
+		{"struct { int64; *^1 }", "struct { int32; *^1 }", false},
+		{"struct { int64; []*^3 }", "struct { int64; []*struct { int64; []*^3 } }", true},
+		{"struct { int64; []*^3 }", "struct { int64; []*struct { int32; []*^3 } }", false},
+		{"raw(a.T)", "raw(a.T)", true},
+		{"raw(a.T)", "binary(a.T)", false},
+		{"interface", "interface", true},
+		{"int8", "int8 int8", false},
+	} {
+		err := raw.Compatible(tc.written, tc.reading)
+		if tc.compatible && err != nil {
+			t.Fatalf("Compatible('%s', '%s') failed: %s", tc.written, tc.reading, err)
+		}
+		if !tc.compatible && err == nil {
+			t.Fatalf("Compatible('%s', '%s') succeeded", tc.written, tc.reading)
+		}
+	}
+	err := raw.Compatible("struct { int8; []int32 }", "struct { int8; []int64 }")
+	if !errors.Is(err, raw.SignatureMismatchError) {
+		t.Fatalf("Compatible() error mismatch: expected SignatureMismatchError, received %v", err)
+	}
+	t.Logf("incompatibility: %s", err)
+}
+
+type testDump struct {
+	Name   string
+	Count  int16
+	Ratio  float32
+	Wave   complex128
+	Flags  [2]bool
+	Scores map[string]uint
+	Tree   *testNode
+	Empty  *testNode
+	Event  testEvent
+	None   testEvent
+	At     time.Time
+	Amount *big.Int
+	Price  testMoney
+	Extra  struct {
+		A int64  `raw:"1"`
+		B string `raw:"2"`
+	}
+}
+
+func TestReadValue(t *testing.T) {
+	err := raw.Register("click", testClick{})
+	if err != nil {
+		t.Fatalf("Register() failed: %s", err)
+	}
+	root := &testNode{Value: random_int64()}
+	root.Children = []*testNode{{Value: random_int64(), Parent: &testNode{Value: root.Value}}, {Value: random_int64()}}
+	myData := testDump{
+		Name:   strconv.Itoa(int(random_uint32())),
+		Count:  random_int16(),
+		Ratio:  random_float32(),
+		Wave:   complex(random_float64(), random_float64()),
+		Flags:  [2]bool{true, false},
+		Scores: map[string]uint{"a": uint(random_uint64()), "b": uint(random_uint64()), "c": 7},
+		Tree:   root,
+		Event:  testClick{At: random_int64(), X: random_int32(), Y: random_int32()},
+		At:     time.Unix(random_int64()%1e10, int64(random_uint32()%1e9)).UTC(),
+		Amount: big.NewInt(random_int64()),
+		Price:  testMoney{cents: random_int64()},
+	}
+	myData.Extra.A = random_int64()
+	myData.Extra.B = "extra"
+	e, err := raw.New(&myData)
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	var b bytes.Buffer
+	_, err = e.WriteTo(&b)
+	if err != nil {
+		t.Fatalf("WriteTo() failed: %s", err)
+	}
+	v, err := raw.ReadValue(e.Signature(), bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatalf("ReadValue() failed: %s", err)
+	}
+	if len(v.Elems) != 14 {
+		t.Fatalf("ReadValue() mismatch: expected 14 fields, received %v", len(v.Elems))
+	}
+	if v.Elems[0].String != myData.Name || v.Elems[1].Int != int64(myData.Count) || v.Elems[2].Float != float64(myData.Ratio) || v.Elems[3].Complex != myData.Wave {
+		t.Fatalf("ReadValue() mismatch of basic kinds: received %+v", v.Elems[:4])
+	}
+	tree := v.Elems[6].Elem
+	if tree.Elems[0].Int != root.Value || tree.Elems[2].Elems[0].Elem.Elems[1].Elem.Elems[0].Int != root.Value {
+		t.Fatalf("ReadValue() mismatch of recursive type: received %+v", tree)
+	}
+	if tree.Elems[2].Elems[0].Elem.Signature != tree.Signature {
+		t.Fatalf("ReadValue() mismatch of recursive signature: received '%s'", tree.Elems[2].Elems[0].Elem.Signature)
+	}
+	if v.Elems[7].Elem != nil || v.Elems[9].Elem != nil || v.Elems[9].String != "" {
+		t.Fatalf("ReadValue() mismatch of nil values: received %+v, %+v", v.Elems[7], v.Elems[9])
+	}
+	if event := v.Elems[8]; event.String != "click" || event.Elem.Elems[1].Int != int64(myData.Event.(testClick).X) {
+		t.Fatalf("ReadValue() mismatch of interface: received %+v", event)
+	}
+	if extra := v.Elems[13]; extra.IDs[1] != 2 || extra.Elems[1].String != "extra" {
+		t.Fatalf("ReadValue() mismatch of struct with field IDs: received %+v", extra)
+	}
+	var b2 bytes.Buffer
+	_, err = v.WriteTo(&b2)
+	if err != nil {
+		t.Fatalf("Value.WriteTo() failed: %s", err)
+	}
+	if !bytes.Equal(b2.Bytes(), b.Bytes()) {
+		t.Fatalf("Value.WriteTo() mismatch: expected %v, received %v", b.Bytes(), b2.Bytes())
+	}
+	// Fields of unknown ID are preserved.
+	v, err = raw.ReadValue("struct { 2:string }", bytes.NewReader(b.Bytes()[b.Len()-37:]))
+	if err != nil {
+		t.Fatalf("ReadValue() failed: %s", err)
+	}
+	if v.Elems[0].Signature != nil || v.Elems[1].String != "extra" {
+		t.Fatalf("ReadValue() mismatch of unknown field: received %+v", v)
+	}
+	b2.Reset()
+	_, err = v.WriteTo(&b2)
+	if err != nil {
+		t.Fatalf("Value.WriteTo() failed: %s", err)
+	}
+	if !bytes.Equal(b2.Bytes(), b.Bytes()[b.Len()-37:]) {
+		t.Fatalf("Value.WriteTo() mismatch: expected %v, received %v", b.Bytes()[b.Len()-37:], b2.Bytes())
+	}
+	_, err = raw.ReadValue(e.Signature(), bytes.NewReader(b.Bytes()[:b.Len()-1]))
+	if err == nil {
+		t.Fatalf("ReadValue() of truncated data succeeded")
+	}
+}
+
+type testJSON struct {
+	Dump    testDump
+	Special []float64
+	Sparse  **int32
+	Points  map[[2]int8]string
+	Weird   map[string]bool
+	Limit   uint64
+	Elapsed time.Duration
+	Old     time.Time
+	Huge    big.Float
+	Ratio   big.Rat
+	ID      testID
+}
+
+func TestJSON(t *testing.T) {
+	err := raw.Register("click", testClick{})
+	if err != nil {
+		t.Fatalf("Register() failed: %s", err)
+	}
+	var sparse *int32
+	myData := testJSON{
+		Dump: testDump{
+			Name:   "json\x00\"<>",
+			Count:  random_int16(),
+			Ratio:  random_float32(),
+			Wave:   complex(random_float64(), math.Inf(-1)),
+			Scores: map[string]uint{"a": uint(random_uint64()), "b": 7},
+			Tree:   &testNode{Value: random_int64(), Children: []*testNode{nil, {Value: random_int64()}}},
+			Event:  testClick{At: random_int64(), X: random_int32(), Y: random_int32()},
+			At:     time.Unix(random_int64()%1e10, int64(random_uint32()%1e9)).In(time.FixedZone("XYZ", -3*3600-1)),
+			Amount: new(big.Int).Lsh(big.NewInt(-random_int64()), 100),
+			Price:  testMoney{cents: random_int64()},
+		},
+		Special: []float64{math.NaN(), math.Inf(1), math.Copysign(0, -1), math.MaxFloat64, math.SmallestNonzeroFloat64},
+		Sparse:  &sparse,
+		Points:  map[[2]int8]string{{1, -2}: "a", {3, 4}: "b"},
+		Weird:   map[string]bool{"\xff\xfe": true, "ok": false},
+		Limit:   math.MaxUint64,
+		Elapsed: time.Duration(random_int64()),
+		Old:     time.Date(-300, 1, 2, 3, 4, 5, 6, time.UTC),
+		Ratio:   *big.NewRat(-random_int64(), 7),
+		ID:      testID{id: random_uint32()},
+	}
+	myData.Dump.Extra.A = random_int64()
+	myData.Huge.SetPrec(200).SetMode(big.ToZero).SetInt64(random_int64())
+	myData.Huge.Quo(&myData.Huge, big.NewFloat(3))
+	e, err := raw.New(&myData)
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	var b bytes.Buffer
+	_, err = e.WriteTo(&b)
+	if err != nil {
+		t.Fatalf("WriteTo() failed: %s", err)
+	}
+	j, err := raw.ToJSON(e.Signature(), b.Bytes())
+	if err != nil {
+		t.Fatalf("ToJSON() failed: %s", err)
+	}
+	t.Logf("JSON: %s", j)
+	var x interface{}
+	err = json.Unmarshal(j, &x)
+	if err != nil {
+		t.Fatalf("ToJSON() answered invalid JSON: %s", err)
+	}
+	for _, fragment := range []string{`["NaN","+Inf",-0,`, `[null,`, `[[1,-2],"a"]`, `[{"bytes":"//4="},true]`, `18446744073709551615`, `{"type":"click","value":[`} {
+		if !bytes.Contains(j, []byte(fragment)) {
+			t.Fatalf("ToJSON() mismatch: expected to contain %s", fragment)
+		}
+	}
+	data, err := raw.FromJSON(e.Signature(), j)
+	if err != nil {
+		t.Fatalf("FromJSON() failed: %s", err)
+	}
+	var myData2 testJSON
+	e2, err := raw.New(&myData2)
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	_, err = e2.ReadFrom(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ReadFrom() failed: %s", err)
+	}
+	if !math.IsNaN(myData2.Special[0]) || !math.Signbit(myData2.Special[2]) {
+		t.Fatalf("FromJSON() mismatch of special floats: received %v", myData2.Special)
+	}
+	if !reflect.DeepEqual(myData2.Dump.Scores, myData.Dump.Scores) || !reflect.DeepEqual(myData2.Points, myData.Points) || !reflect.DeepEqual(myData2.Weird, myData.Weird) {
+		t.Fatalf("round trip mismatch of maps: expected %+v, received %+v", myData, myData2)
+	}
+	// Map order may differ; compare the rest as JSON.
+	var j2 [2][]byte
+	for i, d := range []*testJSON{&myData, &myData2} {
+		d.Dump.Scores, d.Points, d.Weird = nil, nil, nil
+		e, err := raw.New(d)
+		if err != nil {
+			t.Fatalf("New() failed: %s", err)
+		}
+		var b bytes.Buffer
+		_, err = e.WriteTo(&b)
+		if err != nil {
+			t.Fatalf("WriteTo() failed: %s", err)
+		}
+		j2[i], err = raw.ToJSON(e.Signature(), b.Bytes())
+		if err != nil {
+			t.Fatalf("ToJSON() failed: %s", err)
+		}
+	}
+	if !bytes.Equal(j2[0], j2[1]) {
+		t.Fatalf("round trip mismatch: expected %s, received %s", j2[0], j2[1])
+	}
+	if myData2.Sparse == nil || *myData2.Sparse != nil || myData2.Old.Year() != -300 || myData2.Huge.Acc() != myData.Huge.Acc() || myData2.Huge.Mode() != big.ToZero || myData2.Huge.Cmp(&myData.Huge) != 0 || myData2.Dump.Name != myData.Dump.Name {
+		t.Fatalf("round trip mismatch: expected %+v, received %+v", myData, myData2)
+	}
+	_, err = raw.FromJSON("[2]int8", []byte("[1, 2, 3]"))
+	if err == nil {
+		t.Fatalf("FromJSON() of bad array length succeeded")
+	}
+	_, err = raw.FromJSON("int8", []byte("300"))
+	if err == nil {
+		t.Fatalf("FromJSON() of overflowing number succeeded")
+	}
+}
+
+func TestCanonicalMaps(t *testing.T) {
+	myData := map[string][]int16{}
+	for i := 0; i < 50; i++ {
+		myData[strconv.Itoa(int(random_uint32()))] = []int16{random_int16()}
+	}
+	e, err := raw.NewWithOptions(&myData, raw.Options{CanonicalMaps: true})
+	if err != nil {
+		t.Fatalf("NewWithOptions() failed: %s", err)
+	}
+	var expected bytes.Buffer
+	_, err = e.WriteTo(&expected)
+	if err != nil {
+		t.Fatalf("WriteTo() failed: %s", err)
+	}
+	for i := 0; i < 10; i++ {
+		var b bytes.Buffer
+		_, err = e.WriteTo(&b)
+		if err != nil {
+			t.Fatalf("WriteTo() failed: %s", err)
+		}
+		if !bytes.Equal(b.Bytes(), expected.Bytes()) {
+			t.Fatalf("WriteTo() mismatch: expected %v, received %v", expected.Bytes(), b.Bytes())
+		}
+	}
+	var myData2 map[string][]int16
+	e2, err := raw.NewWithOptions(&myData2, raw.Options{CanonicalMaps: true})
+	if err != nil {
+		t.Fatalf("NewWithOptions() failed: %s", err)
+	}
+	_, err = e2.ReadFrom(bytes.NewReader(expected.Bytes()))
+	if err != nil {
+		t.Fatalf("ReadFrom() failed: %s", err)
+	}
+	if !reflect.DeepEqual(myData2, myData) {
+		t.Fatalf("ReadFrom() mismatch: expected %v, received %v", myData, myData2)
+	}
+	// Canonical data is recovered by Encoders of New.
+	e3, err := raw.New(&myData2)
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	_, err = e3.ReadFrom(bytes.NewReader(expected.Bytes()))
+	if err != nil {
+		t.Fatalf("ReadFrom() failed: %s", err)
+	}
+	for _, bad := range [][]byte{
+		// keys "b" and "a"
+		{2, 0, 0, 0, 1, 0, 0, 0, 'b', 0, 0, 0, 0, 1, 0, 0, 0, 'a', 0, 0, 0, 0},
+		// keys "a" and "a"
+		{2, 0, 0, 0, 1, 0, 0, 0, 'a', 0, 0, 0, 0, 1, 0, 0, 0, 'a', 0, 0, 0, 0},
+	} {
+		_, err = e3.ReadFrom(bytes.NewReader(bad))
+		if err != nil {
+			t.Fatalf("ReadFrom() failed: %s", err)
+		}
+		_, err = e2.ReadFrom(bytes.NewReader(bad))
+		if !errors.Is(err, raw.NonCanonicalError) {
+			t.Fatalf("ReadFrom() of %v: expected NonCanonicalError, received %v", bad, err)
+		}
+	}
+	one, another := 1, 1
+	pointers := map[*int]bool{&one: true, &another: false}
+	e, err = raw.NewWithOptions(&pointers, raw.Options{CanonicalMaps: true})
+	if err != nil {
+		t.Fatalf("NewWithOptions() failed: %s", err)
+	}
+	_, err = e.WriteTo(io.Discard)
+	if !errors.Is(err, raw.NonCanonicalError) {
+		t.Fatalf("WriteTo() of keys serializing alike: expected NonCanonicalError, received %v", err)
+	}
+	_, err = raw.NewWithOptions(&pointers, raw.Options{CanonicalMaps: true, TrackReferences: true})
+	if err == nil {
+		t.Fatalf("NewWithOptions() with canonical maps and reference tracking succeeded")
+	}
+}
+
+type testReusable struct {
+	Values []int64
+	Index  map[string]int32
+	Detail *testClick
+	Blocks [2][]byte
+	Words  []string
+}
+
+func TestReuse(t *testing.T) {
+	source := testReusable{
+		Values: []int64{random_int64(), random_int64(), random_int64()},
+		Index:  map[string]int32{"a": random_int32(), "b": random_int32()},
+		Detail: &testClick{At: random_int64()},
+		Blocks: [2][]byte{{1, 2, 3}, {4}},
+		Words:  []string{"x", "y"},
+	}
+	es, err := raw.New(&source)
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	var first bytes.Buffer
+	_, err = es.WriteTo(&first)
+	if err != nil {
+		t.Fatalf("WriteTo() failed: %s", err)
+	}
+	source.Values = source.Values[:2]
+	source.Values[1] = random_int64()
+	source.Index = map[string]int32{"c": random_int32()}
+	source.Detail.X = random_int32()
+	source.Blocks[0] = source.Blocks[0][:1]
+	source.Words = nil
+	var second bytes.Buffer
+	_, err = es.WriteTo(&second)
+	if err != nil {
+		t.Fatalf("WriteTo() failed: %s", err)
+	}
+	var myData testReusable
+	e, err := raw.NewWithOptions(&myData, raw.Options{Reuse: true})
+	if err != nil {
+		t.Fatalf("NewWithOptions() failed: %s", err)
+	}
+	_, err = e.ReadFrom(bytes.NewReader(first.Bytes()))
+	if err != nil {
+		t.Fatalf("ReadFrom() failed: %s", err)
+	}
+	values, index, detail, block := &myData.Values[0], reflect.ValueOf(myData.Index).Pointer(), myData.Detail, &myData.Blocks[0][0]
+	_, err = e.ReadFrom(bytes.NewReader(second.Bytes()))
+	if err != nil {
+		t.Fatalf("ReadFrom() failed: %s", err)
+	}
+	if !reflect.DeepEqual(myData.Values, source.Values) || !reflect.DeepEqual(myData.Index, source.Index) || *myData.Detail != *source.Detail || !reflect.DeepEqual(myData.Blocks, source.Blocks) || len(myData.Words) != 0 {
+		t.Fatalf("ReadFrom() mismatch: expected %+v, received %+v", source, myData)
+	}
+	if &myData.Values[0] != values || reflect.ValueOf(myData.Index).Pointer() != index || myData.Detail != detail || &myData.Blocks[0][0] != block {
+		t.Fatalf("ReadFrom() did not reuse allocations")
+	}
+	// Without reuse, new values are created.
+	e, err = raw.New(&myData)
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	_, err = e.ReadFrom(bytes.NewReader(second.Bytes()))
+	if err != nil {
+		t.Fatalf("ReadFrom() failed: %s", err)
+	}
+	if &myData.Values[0] == values || myData.Detail == detail {
+		t.Fatalf("ReadFrom() reused allocations")
+	}
+	// Reuse in ordered format
+	numbers := []int32{random_int32(), random_int32()}
+	e, err = raw.NewWithOptions(&numbers, raw.Options{Ordered: true, Reuse: true})
+	if err != nil {
+		t.Fatalf("NewWithOptions() failed: %s", err)
+	}
+	var b bytes.Buffer
+	_, err = e.WriteTo(&b)
+	if err != nil {
+		t.Fatalf("WriteTo() failed: %s", err)
+	}
+	expected := append([]int32(nil), numbers...)
+	first32 := &numbers[0]
+	numbers[0]++
+	_, err = e.ReadFrom(&b)
+	if err != nil {
+		t.Fatalf("ReadFrom() failed: %s", err)
+	}
+	if !reflect.DeepEqual(numbers, expected) || &numbers[0] != first32 {
+		t.Fatalf("ReadFrom() mismatch in ordered format: expected %v, received %v", expected, numbers)
+	}
+	// Elements that grow from nil do not share allocations.
+	var grown struct {
+		Clicks []*testClick
+		Rows   [][]int32
+		Index  map[string]*testClick
+	}
+	grown.Clicks = []*testClick{{At: random_int64()}, {At: random_int64()}, {At: random_int64()}}
+	grown.Rows = [][]int32{{random_int32(), random_int32()}, {random_int32(), random_int32()}}
+	grown.Index = map[string]*testClick{"a": {At: random_int64()}, "b": {At: random_int64()}}
+	e, err = raw.New(&grown)
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	b.Reset()
+	_, err = e.WriteTo(&b)
+	if err != nil {
+		t.Fatalf("WriteTo() failed: %s", err)
+	}
+	myGrown := grown
+	myGrown.Clicks, myGrown.Rows, myGrown.Index = nil, nil, nil
+	e, err = raw.NewWithOptions(&myGrown, raw.Options{Reuse: true})
+	if err != nil {
+		t.Fatalf("NewWithOptions() failed: %s", err)
+	}
+	_, err = e.ReadFrom(&b)
+	if err != nil {
+		t.Fatalf("ReadFrom() failed: %s", err)
+	}
+	if !reflect.DeepEqual(myGrown, grown) {
+		t.Fatalf("ReadFrom() mismatch: expected %+v, received %+v", grown, myGrown)
+	}
+	if myGrown.Clicks[0] == myGrown.Clicks[1] || myGrown.Clicks[1] == myGrown.Clicks[2] || &myGrown.Rows[0][0] == &myGrown.Rows[1][0] || myGrown.Index["a"] == myGrown.Index["b"] {
+		t.Fatalf("ReadFrom() shared allocations among elements")
+	}
+	// Elements that grow from nil in ordered format
+	rows := grown.Rows
+	e, _ = raw.NewWithOptions(&rows, raw.Options{Ordered: true})
+	b.Reset()
+	_, err = e.WriteTo(&b)
+	if err != nil {
+		t.Fatalf("WriteTo() failed: %s", err)
+	}
+	var myRows [][]int32
+	e, _ = raw.NewWithOptions(&myRows, raw.Options{Ordered: true, Reuse: true})
+	_, err = e.ReadFrom(&b)
+	if err != nil {
+		t.Fatalf("ReadFrom() failed: %s", err)
+	}
+	if !reflect.DeepEqual(myRows, rows) || &myRows[0][0] == &myRows[1][0] {
+		t.Fatalf("ReadFrom() mismatch in ordered format: expected %v, received %v", rows, myRows)
+	}
+	// Interfaces holding values with allocations
+	err = raw.Register("box", testBox{})
+	if err != nil {
+		t.Fatalf("Register() failed: %s", err)
+	}
+	boxes := []testEvent{testBox{Values: []int32{1, 2}}, testBox{Values: []int32{3, 4}}}
+	e, _ = raw.New(&boxes)
+	b.Reset()
+	_, err = e.WriteTo(&b)
+	if err != nil {
+		t.Fatalf("WriteTo() failed: %s", err)
+	}
+	var myBoxes []testEvent
+	e, _ = raw.NewWithOptions(&myBoxes, raw.Options{Reuse: true})
+	_, err = e.ReadFrom(&b)
+	if err != nil {
+		t.Fatalf("ReadFrom() failed: %s", err)
+	}
+	if !reflect.DeepEqual(myBoxes, boxes) {
+		t.Fatalf("ReadFrom() mismatch: expected %v, received %v", boxes, myBoxes)
+	}
+}
+
+type testBox struct {
+	Values []int32
+}
+
+func (testBox) When() int64 { return 0 }
+
+type testNillable struct {
+	Nil      []int16
+	Empty    []int16
+	NilMap   map[string]bool
+	EmptyMap map[string]bool
+	Nested   [][]byte
+}
+
+func TestPreserveNil(t *testing.T) {
+	source := testNillable{
+		Empty:    []int16{},
+		EmptyMap: map[string]bool{},
+		Nested:   [][]byte{nil, {}, {random_uint8()}},
+	}
+	es, err := raw.NewWithOptions(&source, raw.Options{PreserveNil: true})
+	if err != nil {
+		t.Fatalf("NewWithOptions() failed: %s", err)
+	}
+	var b bytes.Buffer
+	_, err = es.WriteTo(&b)
+	if err != nil {
+		t.Fatalf("WriteTo() failed: %s", err)
+	}
+	data := append([]byte(nil), b.Bytes()...)
+	var myData testNillable
+	e, err := raw.NewWithOptions(&myData, raw.Options{PreserveNil: true})
+	if err != nil {
+		t.Fatalf("NewWithOptions() failed: %s", err)
+	}
+	_, err = e.ReadFrom(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ReadFrom() failed: %s", err)
+	}
+	if !reflect.DeepEqual(myData, source) {
+		t.Fatalf("ReadFrom() mismatch: expected %#v, received %#v", source, myData)
+	}
+	// Data written with PreserveNil is understood without it.
+	myData = testNillable{}
+	e, err = raw.New(&myData)
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	_, err = e.ReadFrom(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ReadFrom() failed: %s", err)
+	}
+	if !reflect.DeepEqual(myData, source) {
+		t.Fatalf("ReadFrom() mismatch without PreserveNil: expected %#v, received %#v", source, myData)
+	}
+	// Legacy data decodes as empty.
+	b.Reset()
+	legacy, err := raw.New(&source)
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	_, err = legacy.WriteTo(&b)
+	if err != nil {
+		t.Fatalf("WriteTo() failed: %s", err)
+	}
+	myData = testNillable{Nil: []int16{1}}
+	e, _ = raw.NewWithOptions(&myData, raw.Options{PreserveNil: true})
+	_, err = e.ReadFrom(&b)
+	if err != nil {
+		t.Fatalf("ReadFrom() failed: %s", err)
+	}
+	if myData.Nil == nil || len(myData.Nil) != 0 || myData.NilMap == nil || len(myData.NilMap) != 0 {
+		t.Fatalf("ReadFrom() mismatch of legacy data: expected empty values, received %#v", myData)
+	}
+	// Self-describing data tolerates a mismatch of PreserveNil.
+	b.Reset()
+	es, _ = raw.NewWithOptions(&source, raw.Options{SelfDescribing: true, PreserveNil: true})
+	_, err = es.WriteTo(&b)
+	if err != nil {
+		t.Fatalf("WriteTo() failed: %s", err)
+	}
+	myData = testNillable{}
+	e, _ = raw.NewWithOptions(&myData, raw.Options{SelfDescribing: true})
+	_, err = e.ReadFrom(&b)
+	if err != nil {
+		t.Fatalf("ReadFrom() failed: %s", err)
+	}
+	if !reflect.DeepEqual(myData, source) {
+		t.Fatalf("ReadFrom() mismatch of self-describing data: expected %#v, received %#v", source, myData)
+	}
+	// Nil is transcoded as null.
+	j, err := raw.ToJSON(es.Signature(), data)
+	if err != nil {
+		t.Fatalf("ToJSON() failed: %s", err)
+	}
+	expected := fmt.Sprintf("[null,[],null,{},[null,[],[%v]]]", source.Nested[2][0])
+	if string(j) != expected {
+		t.Fatalf("ToJSON() mismatch: expected %s, received %s", expected, j)
+	}
+	_, err = raw.NewWithOptions(&source, raw.Options{Ordered: true, PreserveNil: true})
+	if err == nil {
+		t.Fatalf("NewWithOptions() accepted Ordered with PreserveNil")
+	}
+}
+
+func TestLengthOverflow(t *testing.T) {
+	// Elements of zero size let a huge slice fit in memory.
+	myData := make([]struct{}, 1<<32)
+	e, err := raw.New(&myData)
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	_, err = e.WriteTo(io.Discard)
+	if !errors.Is(err, raw.LengthOverflowError) {
+		t.Fatalf("WriteTo() error mismatch: expected LengthOverflowError, received %v", err)
+	}
+	_, err = e.Read(make([]byte, 1))
+	if !errors.Is(err, raw.LengthOverflowError) {
+		t.Fatalf("Read() error mismatch: expected LengthOverflowError, received %v", err)
+	}
+}
+
+type testVarint struct {
+	Short  string
+	Long   []byte
+	Nil    []int8
+	Index  map[uint8]string
+	Any    interface{}
+	Tagged struct {
+		X int32   `raw:"1"`
+		Y []int32 `raw:"2"`
+	}
+}
+
+func TestVarintLengths(t *testing.T) {
+	source := testVarint{
+		Short: strconv.Itoa(int(random_uint16())),
+		Long:  make([]byte, 127+int(random_uint8())),
+		Index: map[uint8]string{random_uint8(): "x"},
+		Any:   testClick{At: random_int64()},
+	}
+	rand.Read(source.Long)
+	source.Tagged.X = random_int32()
+	source.Tagged.Y = []int32{random_int32()}
+	es, err := raw.NewWithOptions(&source, raw.Options{VarintLengths: true, PreserveNil: true})
+	if err != nil {
+		t.Fatalf("NewWithOptions() failed: %s", err)
+	}
+	var b bytes.Buffer
+	_, err = es.WriteTo(&b)
+	if err != nil {
+		t.Fatalf("WriteTo() failed: %s", err)
+	}
+	if b.Bytes()[0] != byte(len(source.Short)+1) {
+		t.Fatalf("WriteTo() mismatch of short length: expected %#x, received %#x", len(source.Short)+1, b.Bytes()[0])
+	}
+	var myData testVarint
+	e, err := raw.NewWithOptions(&myData, raw.Options{VarintLengths: true})
+	if err != nil {
+		t.Fatalf("NewWithOptions() failed: %s", err)
+	}
+	_, err = e.ReadFrom(&b)
+	if err != nil {
+		t.Fatalf("ReadFrom() failed: %s", err)
+	}
+	if !reflect.DeepEqual(myData, source) {
+		t.Fatalf("ReadFrom() mismatch: expected %#v, received %#v", source, myData)
+	}
+	// Lengths take as many bytes as needed.
+	for length, expected := range map[int]int{0: 1, 126: 1, 127: 2, 16382: 2, 16383: 3} {
+		s := make([]byte, length)
+		e, _ := raw.NewWithOptions(&s, raw.Options{VarintLengths: true})
+		b.Reset()
+		e.WriteTo(&b)
+		if b.Len()-length != expected {
+			t.Fatalf("WriteTo() mismatch for length %v: expected %v bytes of length, received %v", length, expected, b.Len()-length)
+		}
+		s = nil
+		_, err = e.ReadFrom(&b)
+		if err != nil || len(s) != length {
+			t.Fatalf("ReadFrom() failed for length %v: %v", length, err)
+		}
+	}
+	var s string
+	e, _ = raw.NewWithOptions(&s, raw.Options{VarintLengths: true})
+	_, err = e.ReadFrom(bytes.NewReader([]byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x7F}))
+	if err == nil {
+		t.Fatalf("ReadFrom() accepted a varint overflowing 64 bits")
+	}
+	_, err = e.ReadFrom(bytes.NewReader([]byte{0x85}))
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("ReadFrom() error mismatch: expected io.ErrUnexpectedEOF, received %v", err)
+	}
+	// Hostile lengths whose size in bytes overflows 64 bits
+	var numbers []int32
+	e, _ = raw.NewWithOptions(&numbers, raw.Options{VarintLengths: true})
+	_, err = e.ReadFrom(bytes.NewReader(binary.AppendUvarint(nil, 1<<62+1)))
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("ReadFrom() error mismatch of hostile length: expected io.ErrUnexpectedEOF, received %v", err)
+	}
+	// Self-describing data tells lengths apart.
+	es, _ = raw.NewWithOptions(&s, raw.Options{SelfDescribing: true, VarintLengths: true})
+	b.Reset()
+	es.WriteTo(&b)
+	e, _ = raw.NewWithOptions(&s, raw.Options{SelfDescribing: true})
+	_, err = e.ReadFrom(&b)
+	if !errors.Is(err, raw.BadHeaderError) {
+		t.Fatalf("ReadFrom() error mismatch: expected BadHeaderError, received %v", err)
+	}
+	_, err = raw.NewWithOptions(&s, raw.Options{Ordered: true, VarintLengths: true})
+	if err == nil {
+		t.Fatalf("NewWithOptions() accepted Ordered with VarintLengths")
+	}
+}
+
+func TestStream(t *testing.T) {
+	var myData testClick
+	e, err := raw.New(&myData)
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	var b bytes.Buffer
+	w := raw.NewStreamWriter(&b, e)
+	records := make([]testClick, 4)
+	var starts []int
+	for i := range records {
+		records[i] = testClick{At: random_int64(), X: random_int32(), Y: random_int32()}
+		myData = records[i]
+		starts = append(starts, b.Len())
+		err = w.WriteRecord()
+		if err != nil {
+			t.Fatalf("WriteRecord() failed: %s", err)
+		}
+	}
+	data := b.Bytes()
+	// Intact stream
+	r := raw.NewStreamReader(bytes.NewReader(data), e)
+	for i := range records {
+		err = r.Next()
+		if err != nil {
+			t.Fatalf("Next() failed: %s", err)
+		}
+		if myData != records[i] {
+			t.Fatalf("Next() mismatch: expected %+v, received %+v", records[i], myData)
+		}
+	}
+	err = r.Next()
+	if err != io.EOF {
+		t.Fatalf("Next() error mismatch at end of stream: expected io.EOF, received %v", err)
+	}
+	// Corrupt payload of record 1 and header of record 2.
+	corrupt := append([]byte(nil), data...)
+	corrupt[starts[1]+17]++
+	corrupt[starts[2]+5]++
+	r = raw.NewStreamReader(iotest.OneByteReader(bytes.NewReader(corrupt)), e)
+	var received []testClick
+	var failures int
+	for {
+		err = r.Next()
+		if err == io.EOF {
+			break
+		}
+		if errors.Is(err, raw.CorruptRecordError) {
+			failures++
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Next() failed: %s", err)
+		}
+		received = append(received, myData)
+	}
+	if failures != 2 || !reflect.DeepEqual(received, []testClick{records[0], records[3]}) {
+		t.Fatalf("Next() mismatch after corruption: expected %+v and 2 failures, received %+v and %v failures", []testClick{records[0], records[3]}, received, failures)
+	}
+	// Truncated stream
+	r = raw.NewStreamReader(bytes.NewReader(data[:len(data)-1]), e)
+	for i := 0; i < len(records)-1; i++ {
+		err = r.Next()
+		if err != nil {
+			t.Fatalf("Next() failed: %s", err)
+		}
+	}
+	err = r.Next()
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("Next() error mismatch for truncated record: expected io.ErrUnexpectedEOF, received %v", err)
+	}
+	// Truncated record 1 swallowing the start of record 2
+	truncated := append(append([]byte(nil), data[:starts[2]-3]...), data[starts[2]:]...)
+	r = raw.NewStreamReader(bytes.NewReader(truncated), e)
+	received, failures = nil, 0
+	for {
+		err = r.Next()
+		if err == io.EOF {
+			break
+		}
+		if errors.Is(err, raw.CorruptRecordError) {
+			failures++
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Next() failed: %s", err)
+		}
+		received = append(received, myData)
+	}
+	if failures != 1 || !reflect.DeepEqual(received, []testClick{records[0], records[2], records[3]}) {
+		t.Fatalf("Next() mismatch after truncation: expected %+v and 1 failure, received %+v and %v failures", []testClick{records[0], records[2], records[3]}, received, failures)
+	}
+	// Record with no data
+	var empty struct{}
+	ee, err := raw.New(&empty)
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	var withEmpty bytes.Buffer
+	withEmpty.Write(data[:starts[1]])
+	err = raw.NewStreamWriter(&withEmpty, ee).WriteRecord()
+	if err != nil {
+		t.Fatalf("WriteRecord() failed: %s", err)
+	}
+	withEmpty.Write(data[starts[1]:starts[2]])
+	r = raw.NewStreamReader(bytes.NewReader(withEmpty.Bytes()), e)
+	err = r.Next()
+	if err != nil {
+		t.Fatalf("Next() failed: %s", err)
+	}
+	err = r.Next()
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("Next() error mismatch for record with no data: expected io.ErrUnexpectedEOF, received %v", err)
+	}
+	err = r.Next()
+	if err != nil || myData != records[1] {
+		t.Fatalf("Next() mismatch after record with no data: expected %+v, received %+v and %v", records[1], myData, err)
+	}
+	r = raw.NewStreamReader(bytes.NewReader(withEmpty.Bytes()[starts[1]:]), ee)
+	err = r.Next()
+	if err != nil {
+		t.Fatalf("Next() failed for record with no data: %s", err)
+	}
+}
+
+type testMarshal struct {
+	Name   string
+	Values []float64
+	Next   *testMarshal
+	Index  map[int16]bool
+	Any    interface{}
+}
+
+func TestMarshal(t *testing.T) {
+	source := testMarshal{
+		Name:   strconv.Itoa(int(random_int32())),
+		Values: []float64{random_float64(), random_float64()},
+		Next:   &testMarshal{Name: "next", Values: []float64{}, Index: map[int16]bool{}},
+		Index:  map[int16]bool{random_int16(): true},
+		Any:    testClick{At: random_int64()},
+	}
+	myData := source
+	e, err := raw.New(&myData)
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	var b bytes.Buffer
+	_, err = e.WriteTo(&b)
+	if err != nil {
+		t.Fatalf("WriteTo() failed: %s", err)
+	}
+	data, err := raw.Marshal(source)
+	if err != nil {
+		t.Fatalf("Marshal() failed: %s", err)
+	}
+	if !bytes.Equal(data, b.Bytes()) {
+		t.Fatalf("Marshal() mismatch: expected %v, received %v", b.Bytes(), data)
+	}
+	// Concurrent use
+	done := make(chan error)
+	for i := 0; i < 8; i++ {
+		go func() {
+			var received testMarshal
+			for j := 0; j < 100; j++ {
+				data, err := raw.Marshal(source)
+				if err == nil {
+					err = raw.Unmarshal(data, &received)
+				}
+				if err == nil && !reflect.DeepEqual(received, source) {
+					err = fmt.Errorf("expected %+v, received %+v", source, received)
+				}
+				if err != nil {
+					done <- err
+					return
+				}
+			}
+			done <- nil
+		}()
+	}
+	for i := 0; i < 8; i++ {
+		err = <-done
+		if err != nil {
+			t.Fatalf("Marshal() and Unmarshal() failed: %s", err)
+		}
+	}
+	// Pointers are serialized as such.
+	data, err = raw.Marshal(&source.Values)
+	if err != nil {
+		t.Fatalf("Marshal() failed: %s", err)
+	}
+	var values *[]float64
+	err = raw.Unmarshal(data, &values)
+	if err != nil || !reflect.DeepEqual(*values, source.Values) {
+		t.Fatalf("Unmarshal() mismatch of pointer: expected %v, received %v (%v)", source.Values, values, err)
+	}
+	err = raw.Unmarshal(append(data, 0), &values)
+	if err == nil {
+		t.Fatalf("Unmarshal() accepted trailing bytes")
+	}
+	err = raw.Unmarshal(data, values)
+	if err == nil {
+		t.Fatalf("Unmarshal() accepted data of another type")
+	}
+	_, err = raw.Marshal(make(chan int))
+	if err == nil {
+		t.Fatalf("Marshal() accepted an unsupported type")
+	}
+}
+
+func TestCodec(t *testing.T) {
+	c, err := raw.NewCodec[testMarshal]()
+	if err != nil {
+		t.Fatalf("NewCodec() failed: %s", err)
+	}
+	source := testMarshal{
+		Name:   strconv.Itoa(int(random_int32())),
+		Values: []float64{random_float64()},
+		Index:  map[int16]bool{random_int16(): false},
+		Any:    &testKey{At: random_int64()},
+	}
+	expected, err := raw.Marshal(source)
+	if err != nil {
+		t.Fatalf("Marshal() failed: %s", err)
+	}
+	if c.Signature() != "struct { string; []float64; *^2; map[int16]bool; interface }" {
+		t.Fatalf("Signature() mismatch: received '%s'", c.Signature())
+	}
+	// Concurrent use
+	done := make(chan error)
+	for i := 0; i < 8; i++ {
+		go func() {
+			for j := 0; j < 100; j++ {
+				var b bytes.Buffer
+				err := c.Encode(&b, source)
+				if err == nil && !bytes.Equal(b.Bytes(), expected) {
+					err = fmt.Errorf("Encode() mismatch: expected %v, received %v", expected, b.Bytes())
+				}
+				if err != nil {
+					done <- err
+					return
+				}
+				received, err := c.Decode(&b)
+				if err == nil && !reflect.DeepEqual(received, source) {
+					err = fmt.Errorf("Decode() mismatch: expected %+v, received %+v", source, received)
+				}
+				if err != nil {
+					done <- err
+					return
+				}
+			}
+			done <- nil
+		}()
+	}
+	for i := 0; i < 8; i++ {
+		err = <-done
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+	}
+	// Codec of an interface type
+	ce, err := raw.NewCodecWithOptions[testEvent](raw.Options{SelfDescribing: true})
+	if err != nil {
+		t.Fatalf("NewCodecWithOptions() failed: %s", err)
+	}
+	var b bytes.Buffer
+	click := testClick{At: random_int64()}
+	err = ce.Encode(&b, click)
+	if err != nil {
+		t.Fatalf("Encode() failed: %s", err)
+	}
+	err = ce.Encode(&b, nil)
+	if err != nil {
+		t.Fatalf("Encode() failed: %s", err)
+	}
+	event, err := ce.Decode(&b)
+	if err != nil || event != click {
+		t.Fatalf("Decode() mismatch: expected %+v, received %+v (%v)", click, event, err)
+	}
+	event, err = ce.Decode(&b)
+	if err != nil || event != nil {
+		t.Fatalf("Decode() mismatch: expected nil, received %+v (%v)", event, err)
+	}
+	_, err = ce.Decode(&b)
+	if err != io.EOF {
+		t.Fatalf("Decode() error mismatch: expected io.EOF, received %v", err)
+	}
+	_, err = raw.NewCodec[chan int]()
+	if err == nil {
+		t.Fatalf("NewCodec() accepted an unsupported type")
+	}
+}
+
+type testLine struct {
+	SKU  string
+	Qty  int32
+	Tags []string
+}
+
+type testWide struct {
+	ID     int64
+	Lines  []testLine
+	Notes  string
+	Total  *float64
+	When   time.Time
+	Extra  map[string][]byte
+	Any    interface{}
+	Nested struct {
+		A uint16 `raw:"1"`
+		B []int8 `raw:"2"`
+	}
+}
+
+func TestProjection(t *testing.T) {
+	total := random_float64()
+	source := testWide{
+		ID:    random_int64(),
+		Lines: []testLine{{SKU: "a", Qty: random_int32(), Tags: []string{"x"}}, {SKU: "b", Qty: random_int32(), Tags: []string{}}},
+		Notes: strconv.Itoa(int(random_int32())),
+		Total: &total,
+		When:  time.Unix(random_int64()>>32, 0),
+		Extra: map[string][]byte{"k": {random_uint8()}},
+		Any:   testClick{At: random_int64()},
+	}
+	source.Nested.A = random_uint16()
+	source.Nested.B = []int8{random_int8()}
+	expected := testWide{ID: source.ID, Lines: []testLine{{Qty: source.Lines[0].Qty}, {Qty: source.Lines[1].Qty}}}
+	expected.Nested.B = source.Nested.B
+	for _, o := range []raw.Options{{}, {LengthPrefixed: true}, {LengthPrefixed: true, VarintLengths: true, SelfDescribing: true}} {
+		es, err := raw.NewWithOptions(&source, o)
+		if err != nil {
+			t.Fatalf("NewWithOptions() failed: %s", err)
+		}
+		var b bytes.Buffer
+		_, err = es.WriteTo(&b)
+		if err != nil {
+			t.Fatalf("WriteTo() failed: %s", err)
+		}
+		data := append([]byte(nil), b.Bytes()...)
+		// Whole recovery
+		var whole testWide
+		e, err := raw.NewWithOptions(&whole, o)
+		if err != nil {
+			t.Fatalf("NewWithOptions() failed: %s", err)
+		}
+		_, err = e.ReadFrom(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("ReadFrom() failed with %+v: %s", o, err)
+		}
+		if !reflect.DeepEqual(whole, source) {
+			t.Fatalf("ReadFrom() mismatch with %+v: expected %+v, received %+v", o, source, whole)
+		}
+		// Projection
+		myData := testWide{Notes: "stale"}
+		e, err = raw.NewProjection(&myData, o, "ID", "Lines.Qty", "Nested.B", "Lines.Qty")
+		if err != nil {
+			t.Fatalf("NewProjection() failed: %s", err)
+		}
+		if e.Signature() != es.Signature() {
+			t.Fatalf("Signature() mismatch: expected '%s', received '%s'", es.Signature(), e.Signature())
+		}
+		n, err := e.ReadFrom(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("ReadFrom() of projection failed with %+v: %s", o, err)
+		}
+		if n != int64(len(data)) {
+			t.Fatalf("ReadFrom() of projection consumed %v bytes, expected %v", n, len(data))
+		}
+		if !reflect.DeepEqual(myData, expected) {
+			t.Fatalf("ReadFrom() of projection mismatch with %+v: expected %+v, received %+v", o, expected, myData)
+		}
+	}
+	// Length-prefixed composites are skipped without being parsed.
+	for _, prefixed := range []bool{false, true} {
+		es, _ := raw.NewWithOptions(&source, raw.Options{LengthPrefixed: prefixed})
+		var b bytes.Buffer
+		es.WriteTo(&b)
+		var myData testWide
+		e, err := raw.NewProjection(&myData, raw.Options{LengthPrefixed: prefixed, Limits: raw.Limits{MaxElements: 1}}, "ID")
+		if err != nil {
+			t.Fatalf("NewProjection() failed: %s", err)
+		}
+		_, err = e.ReadFrom(&b)
+		var limitErr *raw.LimitError
+		if errors.As(err, &limitErr) == prefixed {
+			t.Fatalf("ReadFrom() of projection error mismatch with LengthPrefixed %v: received %v", prefixed, err)
+		}
+	}
+	var myData testWide
+	for _, paths := range [][]string{{"Missing"}, {"ID.X"}, {"Extra.K"}, {"Lines..Qty"}, {"When.Sec"}} {
+		_, err := raw.NewProjection(&myData, raw.Options{}, paths...)
+		if err == nil {
+			t.Fatalf("NewProjection() accepted paths %q", paths)
+		}
+	}
+	_, err := raw.NewWithOptions(&myData, raw.Options{Ordered: true, LengthPrefixed: true})
+	if err == nil {
+		t.Fatalf("NewWithOptions() accepted Ordered with LengthPrefixed")
+	}
+}
+
+type testOrders struct {
+	Orders []*testOrder
+}
+
+type testOrder struct {
+	ID    int64
+	Lines map[string]testLine
+}
+
+func TestDecodeError(t *testing.T) {
+	source := testOrders{Orders: make([]*testOrder, 13)}
+	for i := range source.Orders {
+		source.Orders[i] = &testOrder{ID: int64(i), Lines: map[string]testLine{}}
+	}
+	source.Orders[12].Lines["sku"] = testLine{SKU: "x", Qty: random_int32()}
+	var myData testOrders
+	e, err := raw.NewWithOptions(&source, raw.Options{SelfDescribing: true})
+	if err != nil {
+		t.Fatalf("NewWithOptions() failed: %s", err)
+	}
+	var b bytes.Buffer
+	_, err = e.WriteTo(&b)
+	if err != nil {
+		t.Fatalf("WriteTo() failed: %s", err)
+	}
+	// Truncate data within the quantity of the last line.
+	data := b.Bytes()[:b.Len()-6]
+	e, _ = raw.NewWithOptions(&myData, raw.Options{SelfDescribing: true})
+	_, err = e.ReadFrom(bytes.NewReader(data))
+	var de *raw.DecodeError
+	if !errors.As(err, &de) {
+		t.Fatalf("ReadFrom() error mismatch: expected *DecodeError, received %v", err)
+	}
+	if de.Path != `.Orders[12].Lines["sku"].Qty` || de.Signature != "int32" || de.Offset != int64(len(data)-2) {
+		t.Fatalf("ReadFrom() error mismatch: received path %s, signature %s, offset %v", de.Path, de.Signature, de.Offset)
+	}
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("ReadFrom() error mismatch: expected io.ErrUnexpectedEOF, received %v", de.Err)
+	}
+	// Errors of the placeholder variable itself
+	var x int16
+	e, _ = raw.New(&x)
+	_, err = e.ReadFrom(bytes.NewReader(nil))
+	if err != io.EOF {
+		t.Fatalf("ReadFrom() error mismatch at end of data: expected io.EOF, received %v", err)
+	}
+	// Errors of values of ReadValue
+	_, err = raw.ReadValue(e.Signature(), bytes.NewReader(nil))
+	if err != io.EOF {
+		t.Fatalf("ReadValue() error mismatch at end of data: expected io.EOF, received %v", err)
+	}
+	_, err = raw.ReadValue("struct { []int8; [2]int64 }", bytes.NewReader([]byte{0, 0, 0, 0, 1, 2, 3, 4, 5, 6, 7, 8}))
+	if !errors.As(err, &de) || de.Path != ".1[1]" || de.Offset != 12 || de.Signature != "int64" {
+		t.Fatalf("ReadValue() error mismatch: received %v", err)
+	}
+	// Limits and unregistered types
+	var lines []testLine
+	e, _ = raw.NewWithOptions(&lines, raw.Options{Limits: raw.Limits{MaxStringLength: 1}})
+	_, err = e.ReadFrom(bytes.NewReader([]byte{1, 0, 0, 0, 2, 0, 0, 0, 'a', 'b'}))
+	var limitErr *raw.LimitError
+	if !errors.As(err, &limitErr) || !errors.As(err, &de) || de.Path != "[0].SKU" || de.Offset != 4 {
+		t.Fatalf("ReadFrom() error mismatch: received %v", err)
+	}
+	if err.Error() != "[0].SKU: cannot recover string at offset 4: "+limitErr.Error() {
+		t.Fatalf("Error() mismatch: received '%s'", err)
+	}
+}
+
+type testShortRead struct {
+	U8     uint8
+	U16    uint16
+	U32    uint32
+	U64    uint64
+	I8     int8
+	I16    int16
+	I32    int32
+	I64    int64
+	Int    int
+	Uint   uint
+	F32    float32
+	F64    float64
+	C64    complex64
+	C128   complex128
+	Bool   bool
+	Name   string
+	Flags  [3]int16
+	Scores []int32
+	Index  map[string]uint16
+	Ptr    *int64
+	Nil    *int64
+	Click  testEvent
+	Key    testEvent
+	None   testEvent
+	Price  testMoney
+	At     time.Time
+	Wait   time.Duration
+	Count  *big.Int
+	Ratio  big.Rat
+	Amount big.Float
+	Tagged struct {
+		X int32  `raw:"1"`
+		Y string `raw:"2"`
+	}
+}
+
+func TestShortReads(t *testing.T) {
+	ptr := random_int64()
+	basic := testShortRead{
+		U8: random_uint8(), U16: random_uint16(), U32: random_uint32(), U64: random_uint64(),
+		I8: random_int8(), I16: random_int16(), I32: random_int32(), I64: random_int64(),
+		Int: int(random_int64()), Uint: uint(random_uint64()),
+		F32: random_float32(), F64: random_float64(),
+		C64: complex(random_float32(), random_float32()), C128: complex(random_float64(), random_float64()),
+		Bool:   true,
+		Name:   strconv.Itoa(int(random_uint32())),
+		Flags:  [3]int16{random_int16(), random_int16(), random_int16()},
+		Scores: []int32{random_int32(), random_int32()},
+		Index:  map[string]uint16{"x": random_uint16()},
+		Ptr:    &ptr,
+		Click:  testClick{At: random_int64(), X: random_int32(), Y: random_int32()},
+		Key:    &testKey{At: random_int64(), Key: "k"},
+		Price:  testMoney{cents: random_int64()},
+		At:     time.Date(2016, time.October, 12, 18, 0, 0, 123, time.FixedZone("XYZ", -3*3600)),
+		Wait:   time.Duration(random_int64()),
+		Count:  big.NewInt(random_int64()),
+	}
+	basic.Ratio.SetFrac64(random_int64(), int64(random_uint32())+1)
+	basic.Amount.SetPrec(200).SetFloat64(random_float64())
+	basic.Tagged.X = random_int32()
+	basic.Tagged.Y = "y"
+	tree := &testNode{Value: random_int64()}
+	tree.Children = []*testNode{{Value: random_int64(), Parent: tree, Children: []*testNode{}}}
+	ordered := struct {
+		A int16
+		B float64
+		C string
+		D []int32
+		E [2]float32
+	}{random_int16(), random_float64(), "c", []int32{random_int32()}, [2]float32{random_float32(), random_float32()}}
+	varint := testVarint{Short: "s", Long: []byte{1, 2, 3}, Index: map[uint8]string{1: "x"}, Any: testClick{At: random_int64()}}
+	varint.Tagged.Y = []int32{random_int32()}
+	cases := []struct {
+		name    string
+		source  interface{}
+		options raw.Options
+	}{
+		{"basic", &basic, raw.Options{}},
+		{"self-describing", &basic, raw.Options{SelfDescribing: true}},
+		{"canonical maps", &basic, raw.Options{CanonicalMaps: true}},
+		{"length-prefixed", &basic, raw.Options{LengthPrefixed: true}},
+		{"varint lengths", &varint, raw.Options{VarintLengths: true, PreserveNil: true}},
+		{"preserve nil", &testNillable{Empty: []int16{}, EmptyMap: map[string]bool{}, Nested: [][]byte{nil, {}}}, raw.Options{PreserveNil: true}},
+		{"track references", &tree, raw.Options{TrackReferences: true}},
+		{"ordered", &ordered, raw.Options{Ordered: true}},
+	}
+	for _, c := range cases {
+		encoder, err := raw.NewWithOptions(c.source, c.options)
+		if err != nil {
+			t.Fatalf("%s: NewWithOptions() failed: %s", c.name, err)
+		}
+		var b bytes.Buffer
+		_, err = encoder.WriteTo(&b)
+		if err != nil {
+			t.Fatalf("%s: WriteTo() failed: %s", c.name, err)
+		}
+		data := b.Bytes()
+		target := reflect.New(reflect.TypeOf(c.source).Elem())
+		decoder, _ := raw.NewWithOptions(target.Interface(), c.options)
+		n, err := decoder.ReadFrom(iotest.OneByteReader(bytes.NewReader(data)))
+		if err != nil {
+			t.Fatalf("%s: ReadFrom() failed: %s", c.name, err)
+		}
+		if n != int64(len(data)) {
+			t.Fatalf("%s: ReadFrom() length mismatch: expected %v, received %v", c.name, len(data), n)
+		}
+		// Recovered data must serialize back to the same sequence.
+		var b2 bytes.Buffer
+		_, err = decoder.WriteTo(&b2)
+		if err != nil {
+			t.Fatalf("%s: WriteTo() failed: %s", c.name, err)
+		}
+		if !bytes.Equal(b2.Bytes(), data) {
+			t.Fatalf("%s: marshal / unmarshal mismatch: expected %v, received %v", c.name, data, b2.Bytes())
+		}
+		_, err = decoder.ReadFrom(iotest.DataErrReader(iotest.HalfReader(bytes.NewReader(data))))
+		if err != nil {
+			t.Fatalf("%s: ReadFrom() of half reads failed: %s", c.name, err)
+		}
+		// Truncated data
+		_, err = decoder.ReadFrom(iotest.OneByteReader(bytes.NewReader(nil)))
+		if err != io.EOF {
+			t.Fatalf("%s: ReadFrom() error mismatch at end of data: expected io.EOF, received %v", c.name, err)
+		}
+		for i := 1; i < len(data); i++ {
+			_, err = decoder.ReadFrom(iotest.OneByteReader(bytes.NewReader(data[:i])))
+			if !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Fatalf("%s: ReadFrom() error mismatch of %v out of %v bytes: expected io.ErrUnexpectedEOF, received %v", c.name, i, len(data), err)
+			}
+		}
+	}
+	// Values of ReadValue
+	encoder, _ := raw.New(&basic)
+	var b bytes.Buffer
+	encoder.WriteTo(&b)
+	data := b.Bytes()
+	v, err := raw.ReadValue(encoder.Signature(), iotest.OneByteReader(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatalf("ReadValue() failed: %s", err)
+	}
+	b.Reset()
+	v.WriteTo(&b)
+	if !bytes.Equal(b.Bytes(), data) {
+		t.Fatalf("ReadValue() mismatch: expected %v, received %v", data, b.Bytes())
+	}
+	for i := 1; i < len(data); i++ {
+		_, err = raw.ReadValue(encoder.Signature(), iotest.OneByteReader(bytes.NewReader(data[:i])))
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("ReadValue() error mismatch of %v out of %v bytes: expected io.ErrUnexpectedEOF, received %v", i, len(data), err)
+		}
+	}
+}
+
+type testAudit struct {
+	Created int64
+	Author  string
+}
+
+type testStamp struct {
+	Created int64
+	Zone    string
+}
+
+type testAccount struct {
+	testAudit
+	Owner   string
+	Balance int64
+	Author  string
+	Ratio   float64 `raw:"-"`
+	cache   map[string]int64
+	mu      sync.Mutex
+}
+
+func TestStructFieldControl(t *testing.T) {
+	var account testAccount
+	_, err := raw.NewWithOptions(&account, raw.Options{PromoteEmbedded: true})
+	if err == nil || err.Error() != "struct field 'cache' is unexported" {
+		t.Fatalf("NewWithOptions() error mismatch: received %v", err)
+	}
+	options := raw.Options{IgnoreUnexported: true, PromoteEmbedded: true}
+	encoder, err := raw.NewWithOptions(&account, options)
+	if err != nil {
+		t.Fatalf("NewWithOptions() failed: %s", err)
+	}
+	expected_signature := "struct { int64; string; int64; string }"
+	if encoder.Signature() != expected_signature {
+		t.Fatalf("signature mismatch: expected '%s', received '%s'", expected_signature, encoder.Signature())
+	}
+	// Skipped fields are left untouched
+	account.Created = random_int64()
+	account.testAudit.Author = "hidden"
+	account.Owner = "owner"
+	account.Balance = random_int64()
+	account.Author = "author"
+	account.Ratio = random_float64()
+	var b bytes.Buffer
+	_, err = encoder.WriteTo(&b)
+	if err != nil {
+		t.Fatalf("WriteTo() failed: %s", err)
+	}
+	var myData testAccount
+	myData.Ratio = 1.5
+	myData.cache = map[string]int64{"x": 1}
+	decoder, _ := raw.NewWithOptions(&myData, options)
+	_, err = decoder.ReadFrom(&b)
+	if err != nil {
+		t.Fatalf("ReadFrom() failed: %s", err)
+	}
+	if myData.Created != account.Created || myData.Owner != account.Owner || myData.Balance != account.Balance || myData.Author != account.Author {
+		t.Fatalf("marshal / unmarshal mismatch: expected %+v, received %+v", &account, &myData)
+	}
+	if myData.testAudit.Author != "" || myData.Ratio != 1.5 || myData.cache["x"] != 1 {
+		t.Fatalf("recovery of skipped fields: received %+v", &myData)
+	}
+	// Promotion of embedded structs
+	for _, c := range []struct {
+		placeholder interface{}
+		signature   string
+	}{
+		{new(struct {
+			testAudit
+			testStamp
+		}), "struct { string; string }"},
+		{new(struct {
+			*testAudit
+			Note string
+		}), "struct { string }"},
+		{new(struct {
+			testAudit
+			Note string `raw:"1"`
+		}), ""},
+		{new(struct {
+			sync.Mutex
+			Count int
+		}), "struct { int }"},
+	} {
+		e, err := raw.NewWithOptions(c.placeholder, options)
+		if c.signature == "" {
+			if err == nil {
+				t.Fatalf("NewWithOptions() of %T succeeded", c.placeholder)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("NewWithOptions() of %T failed: %s", c.placeholder, err)
+		}
+		if e.Signature() != c.signature {
+			t.Fatalf("signature mismatch: expected '%s', received '%s'", c.signature, e.Signature())
+		}
+	}
+	// Projections of promoted fields
+	account.Created = random_int64()
+	b.Reset()
+	encoder.WriteTo(&b)
+	myData = testAccount{}
+	projected, err := raw.NewProjection(&myData, options, "Created")
+	if err != nil {
+		t.Fatalf("NewProjection() failed: %s", err)
+	}
+	_, err = projected.ReadFrom(&b)
+	if err != nil {
+		t.Fatalf("ReadFrom() failed: %s", err)
+	}
+	if myData.Created != account.Created || myData.Owner != "" {
+		t.Fatalf("projection mismatch: received %+v", &myData)
+	}
+	// Without promotion, embedded structs keep their signature
+	// and data serialized by previous versions is recovered.
+	type Inner struct{ A int64 }
+	var nested struct {
+		Inner
+		X int64
+	}
+	e, err := raw.NewWithOptions(&nested, raw.Options{SelfDescribing: true})
+	if err != nil {
+		t.Fatalf("NewWithOptions() failed: %s", err)
+	}
+	expected_signature = "struct { struct { int64 }; int64 }"
+	if e.Signature() != expected_signature {
+		t.Fatalf("signature mismatch: expected '%s', received '%s'", expected_signature, e.Signature())
+	}
+	previous := struct {
+		Inner Inner
+		X     int64
+	}{Inner{1}, 2}
+	ep, _ := raw.NewWithOptions(&previous, raw.Options{SelfDescribing: true})
+	b.Reset()
+	_, err = ep.WriteTo(&b)
+	if err != nil {
+		t.Fatalf("WriteTo() failed: %s", err)
+	}
+	_, err = e.ReadFrom(&b)
+	if err != nil {
+		t.Fatalf("ReadFrom() of previous data failed: %s", err)
+	}
+	if nested.A != 1 || nested.X != 2 {
+		t.Fatalf("ReadFrom() mismatch of previous data: received %+v", nested)
+	}
+}
@@ -24,6 +24,22 @@ package raw
 // Implementation of io.ReadWriter for Encoder
 //
 
+func (e uintEncoder) Read(p []byte) (int, error) {
+	return readEncoder(e, p)
+}
+
+func (e uintEncoder) Write(p []byte) (int, error) {
+	return writeEncoder(e, p)
+}
+
+func (e uintptrEncoder) Read(p []byte) (int, error) {
+	return readEncoder(e, p)
+}
+
+func (e uintptrEncoder) Write(p []byte) (int, error) {
+	return writeEncoder(e, p)
+}
+
 func (e uint8Encoder) Read(p []byte) (int, error) {
 	return readEncoder(e, p)
 }
@@ -56,6 +72,14 @@ func (e uint64Encoder) Write(p []byte) (int, error) {
 	return writeEncoder(e, p)
 }
 
+func (e intEncoder) Read(p []byte) (int, error) {
+	return readEncoder(e, p)
+}
+
+func (e intEncoder) Write(p []byte) (int, error) {
+	return writeEncoder(e, p)
+}
+
 func (e int8Encoder) Read(p []byte) (int, error) {
 	return readEncoder(e, p)
 }
@@ -160,6 +184,14 @@ func (e structEncoder) Write(p []byte) (int, error) {
 	return writeEncoder(e, p)
 }
 
+func (e taggedStructEncoder) Read(p []byte) (int, error) {
+	return readEncoder(e, p)
+}
+
+func (e taggedStructEncoder) Write(p []byte) (int, error) {
+	return writeEncoder(e, p)
+}
+
 func (e ptrEncoder) Read(p []byte) (int, error) {
 	return readEncoder(e, p)
 }
@@ -175,3 +207,99 @@ func (e mapEncoder) Read(p []byte) (int, error) {
 func (e mapEncoder) Write(p []byte) (int, error) {
 	return writeEncoder(e, p)
 }
+
+func (e interfaceEncoder) Read(p []byte) (int, error) {
+	return readEncoder(e, p)
+}
+
+func (e interfaceEncoder) Write(p []byte) (int, error) {
+	return writeEncoder(e, p)
+}
+
+func (e lazyEncoder) Read(p []byte) (int, error) {
+	return readEncoder(e, p)
+}
+
+func (e lazyEncoder) Write(p []byte) (int, error) {
+	return writeEncoder(e, p)
+}
+
+func (e orderedEncoder) Read(p []byte) (int, error) {
+	return readEncoder(e, p)
+}
+
+func (e orderedEncoder) Write(p []byte) (int, error) {
+	return writeEncoder(e, p)
+}
+
+func (e orderedStringEncoder) Read(p []byte) (int, error) {
+	return readEncoder(e, p)
+}
+
+func (e orderedStringEncoder) Write(p []byte) (int, error) {
+	return writeEncoder(e, p)
+}
+
+func (e marshalerEncoder) Read(p []byte) (int, error) {
+	return readEncoder(e, p)
+}
+
+func (e marshalerEncoder) Write(p []byte) (int, error) {
+	return writeEncoder(e, p)
+}
+
+func (e timeEncoder) Read(p []byte) (int, error) {
+	return readEncoder(e, p)
+}
+
+func (e timeEncoder) Write(p []byte) (int, error) {
+	return writeEncoder(e, p)
+}
+
+func (e durationEncoder) Read(p []byte) (int, error) {
+	return readEncoder(e, p)
+}
+
+func (e durationEncoder) Write(p []byte) (int, error) {
+	return writeEncoder(e, p)
+}
+
+func (e bigIntEncoder) Read(p []byte) (int, error) {
+	return readEncoder(e, p)
+}
+
+func (e bigIntEncoder) Write(p []byte) (int, error) {
+	return writeEncoder(e, p)
+}
+
+func (e bigFloatEncoder) Read(p []byte) (int, error) {
+	return readEncoder(e, p)
+}
+
+func (e bigFloatEncoder) Write(p []byte) (int, error) {
+	return writeEncoder(e, p)
+}
+
+func (e bigRatEncoder) Read(p []byte) (int, error) {
+	return readEncoder(e, p)
+}
+
+func (e bigRatEncoder) Write(p []byte) (int, error) {
+	return writeEncoder(e, p)
+}
+
+func (e prefixedEncoder) Read(p []byte) (int, error) {
+	return readEncoder(e, p)
+}
+
+func (e prefixedEncoder) Write(p []byte) (int, error) {
+	return writeEncoder(e, p)
+}
+
+func (e skipEncoder) Read(p []byte) (int, error) {
+	return readEncoder(e, p)
+}
+
+func (e skipEncoder) Write(p []byte) (int, error) {
+	return writeEncoder(e, p)
+}
@@ -0,0 +1,55 @@
+// Copyright 2016 Rafael Lorandi <coolparadox@gmail.com>
+// This file is part of Raw, a binary encoder of Go types.
+//
+// Raw is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Raw is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Raw. If not, see <http://www.gnu.org/licenses/>.
+
+// Package example demonstrates encoders generated by read_writer_gen.
+package example
+
+//go:generate go run ../read_writer_gen.go -type Order
+
+// Order is a sample type covering the kinds supported by read_writer_gen.
+type Order struct {
+	Audit
+	ID       uint
+	Customer string
+	Paid     bool
+	Total    float64
+	Discount *float32
+	Lines    []Line
+	Tags     map[string]int16
+	Origin   [2]complex64
+	Next     *Order
+	Meta     Meta
+	checked  bool `raw:"-"`
+}
+
+// Audit holds tracking data embedded in an Order.
+type Audit struct {
+	Created int64
+	Author  string
+}
+
+// Line is an item of an Order.
+type Line struct {
+	SKU      string
+	Quantity int
+}
+
+// Meta holds extension data of an Order.
+type Meta struct {
+	Version uint8  `raw:"1"`
+	Note    string `raw:"2"`
+	Weight  int32  `raw:"3"`
+}
@@ -0,0 +1,99 @@
+// Copyright 2016 Rafael Lorandi <coolparadox@gmail.com>
+// This file is part of Raw, a binary encoder of Go types.
+//
+// Raw is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Raw is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Raw. If not, see <http://www.gnu.org/licenses/>.
+
+package example_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/coolparadox/go/encoding/raw"
+	"github.com/coolparadox/go/encoding/raw/read_writer_gen/example"
+)
+
+func sample() example.Order {
+	discount := float32(0.15)
+	return example.Order{
+		Audit:    example.Audit{Created: 1476295200, Author: "Farmer Maggot"},
+		ID:       42,
+		Customer: "Tom Bombadil",
+		Paid:     true,
+		Total:    -12.5,
+		Discount: &discount,
+		Lines:    []example.Line{{"pipe", -3}, {"hat", 1}},
+		Tags:     map[string]int16{"priority": -7},
+		Origin:   [2]complex64{complex(1, -2), complex(0, 0.5)},
+		Next:     &example.Order{ID: 43, Customer: "Goldberry"},
+		Meta:     example.Meta{Version: 2, Note: "fragile", Weight: -300},
+	}
+}
+
+func TestGeneratedEncoder(t *testing.T) {
+	var generated, reflective example.Order
+	ge := example.NewOrderRawEncoder(&generated)
+	re, err := raw.New(&reflective)
+	if err != nil {
+		t.Fatalf("raw.New failed: %s", err)
+	}
+	if ge.Signature() != re.Signature() {
+		t.Fatalf("signature mismatch: expected '%s', received '%s'", re.Signature(), ge.Signature())
+	}
+	generated, reflective = sample(), sample()
+	var gb, rb bytes.Buffer
+	_, err = ge.WriteTo(&gb)
+	if err != nil {
+		t.Fatalf("generated WriteTo failed: %s", err)
+	}
+	_, err = re.WriteTo(&rb)
+	if err != nil {
+		t.Fatalf("reflective WriteTo failed: %s", err)
+	}
+	if !bytes.Equal(gb.Bytes(), rb.Bytes()) {
+		t.Fatalf("encoding mismatch: expected %x, received %x", rb.Bytes(), gb.Bytes())
+	}
+	generated, reflective = example.Order{}, example.Order{}
+	_, err = re.ReadFrom(bytes.NewReader(rb.Bytes()))
+	if err != nil {
+		t.Fatalf("reflective ReadFrom failed: %s", err)
+	}
+	n, err := ge.ReadFrom(bytes.NewReader(rb.Bytes()))
+	if err != nil {
+		t.Fatalf("generated ReadFrom failed: %s", err)
+	}
+	if n != int64(rb.Len()) {
+		t.Fatalf("generated ReadFrom consumed %v bytes, expected %v", n, rb.Len())
+	}
+	if !reflect.DeepEqual(generated, reflective) {
+		t.Fatalf("value mismatch: expected %#v, received %#v", reflective, generated)
+	}
+}
+
+func TestGeneratedEncoderTruncated(t *testing.T) {
+	order := sample()
+	e := example.NewOrderRawEncoder(&order)
+	var b bytes.Buffer
+	_, err := e.WriteTo(&b)
+	if err != nil {
+		t.Fatalf("WriteTo failed: %s", err)
+	}
+	for i := 0; i < b.Len(); i++ {
+		_, err = e.ReadFrom(bytes.NewReader(b.Bytes()[:i]))
+		if err == nil {
+			t.Fatalf("ReadFrom of %v of %v bytes succeeded", i, b.Len())
+		}
+	}
+}
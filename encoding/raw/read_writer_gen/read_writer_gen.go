@@ -14,19 +14,48 @@
 // You should have received a copy of the GNU General Public License
 // along with Raw. If not, see <http://www.gnu.org/licenses/>.
 
+/*
+Read_writer_gen generates code for package raw.
+
+When run without flags from the directory of package raw,
+it generates read_writer.go,
+the implementation of io.ReadWriter for Encoders of package raw.
+
+When run with flag -type,
+it generates a reflection-free Serializer for a named type
+of the package in the current directory
+(see Generated Encoders in package raw):
+
+	read_writer_gen -type Person [-output person_raw.go]
+*/
 package main
 
 import (
+	"bytes"
+	"flag"
 	"fmt"
+	"go/ast"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
 	"io"
 	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 var encoders = []string{
+	"uintEncoder",
+	"uintptrEncoder",
 	"uint8Encoder",
 	"uint16Encoder",
 	"uint32Encoder",
 	"uint64Encoder",
+	"intEncoder",
 	"int8Encoder",
 	"int16Encoder",
 	"int32Encoder",
@@ -40,12 +69,40 @@ var encoders = []string{
 	"arrayEncoder",
 	"sliceEncoder",
 	"structEncoder",
+	"taggedStructEncoder",
 	"ptrEncoder",
 	"mapEncoder",
+	"interfaceEncoder",
+	"lazyEncoder",
+	"orderedEncoder",
+	"orderedStringEncoder",
+	"marshalerEncoder",
+	"timeEncoder",
+	"durationEncoder",
+	"bigIntEncoder",
+	"bigFloatEncoder",
+	"bigRatEncoder",
+	"prefixedEncoder",
+	"skipEncoder",
 }
 
-// main generates read_writer.go
+var (
+	typeName = flag.String("type", "", "name of the type for generating a Serializer")
+	output   = flag.String("output", "", "output file name; default <type>_raw.go")
+)
+
+// main generates read_writer.go,
+// or a Serializer if flag -type is given.
 func main() {
+	flag.Parse()
+	if *typeName != "" {
+		err := gen_serializer(*typeName, *output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "read_writer_gen: %s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 	target, err := os.OpenFile("read_writer.go", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
 	if err != nil {
 		panic(err)
@@ -75,3 +132,528 @@ func gen_write(t io.Writer, e string) {
 	fmt.Fprintf(t, "\treturn writeEncoder(e, p)\n")
 	fmt.Fprintf(t, "}\n")
 }
+
+// rawPath is the import path of package raw.
+const rawPath = "github.com/coolparadox/go/encoding/raw"
+
+// gen_serializer generates a Serializer for a named type
+// of the package in the current directory.
+func gen_serializer(name string, out string) error {
+	if out == "" {
+		out = strings.ToLower(name) + "_raw.go"
+	}
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, ".", func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go") && fi.Name() != out
+	}, 0)
+	if err != nil {
+		return err
+	}
+	if len(pkgs) != 1 {
+		return fmt.Errorf("expected a single package in current directory, found %v", len(pkgs))
+	}
+	var files []*ast.File
+	for _, p := range pkgs {
+		for _, f := range p.Files {
+			files = append(files, f)
+		}
+	}
+	conf := types.Config{
+		Importer: importer.ForCompiler(fset, "source", nil),
+		Error:    func(error) {}, // tolerate errors, eg. references to code not yet generated
+	}
+	pkg, _ := conf.Check(".", fset, files, nil)
+	obj := pkg.Scope().Lookup(name)
+	if obj == nil {
+		return fmt.Errorf("type %s not found", name)
+	}
+	if _, ok := obj.(*types.TypeName); !ok {
+		return fmt.Errorf("%s is not a type", name)
+	}
+	g := &generator{
+		pkg:     pkg,
+		recv:    strings.ToLower(name[:1]) + name[1:] + "RawEncoder",
+		methods: make(map[string]int),
+		imports: map[string]string{"fmt": "fmt", "io": "io", rawPath: "raw"},
+		sizes:   types.SizesFor("gc", "amd64"),
+	}
+	root := obj.Type()
+	signature, err := g.signature(root, nil)
+	if err != nil {
+		return err
+	}
+	g.method(root)
+	for i := 0; i < len(g.queue); i++ {
+		err = g.gen_methods(i, g.queue[i])
+		if err != nil {
+			return err
+		}
+	}
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "// Code generated by read_writer_gen -type %s; DO NOT EDIT.\n\n", name)
+	fmt.Fprintf(&src, "package %s\n\nimport (\n", pkg.Name())
+	paths := make([]string, 0, len(g.imports))
+	for path := range g.imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		fmt.Fprintf(&src, "\t%q\n", path)
+	}
+	fmt.Fprintf(&src, ")\n")
+	fmt.Fprintf(&src, `
+// New%[1]sRawEncoder creates a raw.Encoder for %[1]s values
+// that does not rely on reflection.
+// Parameter placeholder has the same meaning as in raw.New.
+func New%[1]sRawEncoder(placeholder *%[1]s) raw.Encoder {
+	return raw.Wrap(&%[2]s{store: placeholder})
+}
+
+// %[2]s is a raw.Serializer of %[1]s values.
+type %[2]s struct {
+	store   *%[1]s
+	buf     []byte
+	err     error
+	r       io.Reader
+	n       int64
+	scratch [8]byte
+}
+
+func (e *%[2]s) Signature() string {
+	return %[3]q
+}
+
+func (e *%[2]s) WriteTo(w io.Writer) (int64, error) {
+	e.err = nil
+	e.buf = e.append0(e.buf[:0], e.store)
+	if e.err != nil {
+		return 0, e.err
+	}
+	n, err := w.Write(e.buf)
+	return int64(n), err
+}
+
+func (e *%[2]s) ReadFrom(r io.Reader) (int64, error) {
+	e.r, e.n = r, 0
+	err := e.read0(e.store)
+	e.r = nil
+	return e.n, err
+}
+
+// appendInteger appends an unsigned integer number of a given octet depth.
+func (e *%[2]s) appendInteger(b []byte, value uint64, depth int) []byte {
+	for i := 0; i < depth; i++ {
+		b = append(b, byte(value))
+		value >>= 8
+	}
+	return b
+}
+
+// length answers the length of a sequence for serialization,
+// recording an error if it does not fit in the format.
+func (e *%[2]s) length(n int) uint64 {
+	if uint64(n) >= 0xFFFFFFFF && e.err == nil {
+		e.err = fmt.Errorf("%%w: %%v", raw.LengthOverflowError, n)
+	}
+	return uint64(n)
+}
+
+// readInteger reads an unsigned integer number of a given octet depth.
+func (e *%[2]s) readInteger(depth int) (uint64, error) {
+	n, err := io.ReadFull(e.r, e.scratch[:depth])
+	e.n += int64(n)
+	if err != nil {
+		return 0, err
+	}
+	var value uint64
+	for i := depth - 1; i >= 0; i-- {
+		value = value<<8 | uint64(e.scratch[i])
+	}
+	return value, nil
+}
+
+// readBytes reads a byte sequence of a given length,
+// allocating memory as bytes arrive.
+func (e *%[2]s) readBytes(length uint64) ([]byte, error) {
+	b := make([]byte, 0, e.capacity(length, 1))
+	for uint64(len(b)) < length {
+		chunk := length - uint64(len(b))
+		if chunk > 64<<10 {
+			chunk = 64 << 10
+		}
+		start := len(b)
+		b = append(b, make([]byte, chunk)...)
+		n, err := io.ReadFull(e.r, b[start:])
+		e.n += int64(n)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// capacity answers the capacity to allocate
+// for a sequence of a given length and element size,
+// so that allocation grows with the data actually read.
+func (e *%[2]s) capacity(length uint64, size uint64) int {
+	// Divide instead of multiplying, which could overflow.
+	if size == 0 || length <= 64<<10/size {
+		return int(length)
+	}
+	return int(64 << 10 / size)
+}
+`, name, g.recv, signature)
+	src.Write(g.body.Bytes())
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		return fmt.Errorf("cannot format generated code: %s", err)
+	}
+	return os.WriteFile(out, formatted, 0666)
+}
+
+// generator holds the state of the generation of a Serializer.
+// Each type reachable from the generated type
+// is handled by a pair of methods, appendN and readN,
+// where N is the position of the type in queue.
+type generator struct {
+	pkg     *types.Package
+	recv    string
+	methods map[string]int
+	queue   []types.Type
+	imports map[string]string
+	sizes   types.Sizes
+	body    bytes.Buffer
+}
+
+// qualifier answers the package qualifier of a type in generated code,
+// and records the package for import.
+func (g *generator) qualifier(p *types.Package) string {
+	if p == g.pkg {
+		return ""
+	}
+	g.imports[p.Path()] = p.Name()
+	return p.Name()
+}
+
+// typeString answers the expression of a type in generated code.
+func (g *generator) typeString(t types.Type) string {
+	return types.TypeString(t, g.qualifier)
+}
+
+// method answers the number of the methods handling a type,
+// scheduling their generation if needed.
+func (g *generator) method(t types.Type) int {
+	key := types.TypeString(t, nil)
+	if i, ok := g.methods[key]; ok {
+		return i
+	}
+	g.methods[key] = len(g.queue)
+	g.queue = append(g.queue, t)
+	return len(g.queue) - 1
+}
+
+// unsupported verifies if a type is handled by package raw
+// in ways not supported by generated code.
+func (g *generator) unsupported(t types.Type) error {
+	if n, ok := t.(*types.Named); ok {
+		path := ""
+		if n.Obj().Pkg() != nil {
+			path = n.Obj().Pkg().Path()
+		}
+		switch path + "." + n.Obj().Name() {
+		case "time.Time", "time.Duration", "math/big.Int", "math/big.Float", "math/big.Rat":
+			return fmt.Errorf("type %s has built-in support in package raw, not supported by read_writer_gen", t)
+		}
+	}
+	ms := types.NewMethodSet(types.NewPointer(t))
+	for _, m := range []string{"MarshalRaw", "MarshalBinary"} {
+		if ms.Lookup(nil, m) != nil {
+			return fmt.Errorf("type %s may serialize itself, not supported by read_writer_gen", t)
+		}
+	}
+	return nil
+}
+
+// basicSignatures maps basic kinds to their signatures.
+var basicSignatures = map[types.BasicKind]string{
+	types.Bool:       "bool",
+	types.Int:        "int",
+	types.Int8:       "int8",
+	types.Int16:      "int16",
+	types.Int32:      "int32",
+	types.Int64:      "int64",
+	types.Uint:       "uint",
+	types.Uint8:      "uint8",
+	types.Uint16:     "uint16",
+	types.Uint32:     "uint32",
+	types.Uint64:     "uint64",
+	types.Uintptr:    "uintptr",
+	types.Float32:    "float32",
+	types.Float64:    "float64",
+	types.Complex64:  "complex64",
+	types.Complex128: "complex128",
+	types.String:     "string",
+}
+
+// signature answers the signature of a type,
+// computed like package raw does.
+// Parameter stack holds the enclosing types.
+func (g *generator) signature(t types.Type, stack []types.Type) (string, error) {
+	for i := len(stack) - 1; i >= 0; i-- {
+		if types.Identical(stack[i], t) {
+			return "^" + strconv.Itoa(len(stack)-i), nil
+		}
+	}
+	err := g.unsupported(t)
+	if err != nil {
+		return "", err
+	}
+	stack = append(stack, t)
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		if sig, ok := basicSignatures[u.Kind()]; ok {
+			return sig, nil
+		}
+	case *types.Array:
+		sig, err := g.signature(u.Elem(), stack)
+		return "[" + strconv.FormatInt(u.Len(), 10) + "]" + sig, err
+	case *types.Slice:
+		sig, err := g.signature(u.Elem(), stack)
+		return "[]" + sig, err
+	case *types.Pointer:
+		sig, err := g.signature(u.Elem(), stack)
+		return "*" + sig, err
+	case *types.Map:
+		ksig, err := g.signature(u.Key(), stack)
+		if err != nil {
+			return "", err
+		}
+		esig, err := g.signature(u.Elem(), stack)
+		return "map[" + ksig + "]" + esig, err
+	case *types.Struct:
+		fields, err := structFields(u)
+		if err != nil {
+			return "", err
+		}
+		ids, err := fieldIDs(fields)
+		if err != nil {
+			return "", err
+		}
+		sig := "struct {"
+		for i, f := range fields {
+			fsig, err := g.signature(f.typ, stack)
+			if err != nil {
+				return "", err
+			}
+			if i > 0 {
+				sig += ";"
+			}
+			if ids != nil {
+				sig += " " + strconv.FormatUint(uint64(ids[i]), 10) + ":" + fsig
+			} else {
+				sig += " " + fsig
+			}
+		}
+		return sig + " }", nil
+	}
+	return "", fmt.Errorf("type %s is not supported by read_writer_gen", t)
+}
+
+// field is a serialized field of a struct
+// (see Struct Tags in package raw).
+type field struct {
+	name string
+	typ  types.Type
+	tag  string
+}
+
+// structFields answers the serialized fields of a struct,
+// in order of serialization,
+// computed like package raw does with zero Options.
+func structFields(s *types.Struct) ([]field, error) {
+	var fields []field
+	for i := 0; i < s.NumFields(); i++ {
+		f := s.Field(i)
+		tag := reflect.StructTag(s.Tag(i)).Get("raw")
+		if tag == "-" {
+			continue
+		}
+		if !f.Exported() {
+			return nil, fmt.Errorf("struct field '%s' is unexported", f.Name())
+		}
+		fields = append(fields, field{name: f.Name(), typ: f.Type(), tag: tag})
+	}
+	return fields, nil
+}
+
+// fieldIDs answers the field IDs of struct fields (see Struct Tags in package raw),
+// or nil if fields have no IDs.
+func fieldIDs(fields []field) ([]uint32, error) {
+	ids := make([]uint32, len(fields))
+	tagged := 0
+	for i, f := range fields {
+		if f.tag == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(f.tag, 10, 32)
+		if err != nil || id == 0 {
+			return nil, fmt.Errorf("struct field %s has invalid field ID '%s'", f.name, f.tag)
+		}
+		for j := 0; j < i; j++ {
+			if ids[j] == uint32(id) {
+				return nil, fmt.Errorf("struct fields %s and %s share field ID %v", fields[j].name, f.name, id)
+			}
+		}
+		ids[i] = uint32(id)
+		tagged++
+	}
+	if tagged == 0 {
+		return nil, nil
+	}
+	if tagged < len(fields) {
+		return nil, fmt.Errorf("struct has fields both with and without field IDs")
+	}
+	return ids, nil
+}
+
+// integers maps basic kinds of integers to their octet depths.
+var integers = map[types.BasicKind]int{
+	types.Int:     8,
+	types.Int8:    1,
+	types.Int16:   2,
+	types.Int32:   4,
+	types.Int64:   8,
+	types.Uint:    8,
+	types.Uint8:   1,
+	types.Uint16:  2,
+	types.Uint32:  4,
+	types.Uint64:  8,
+	types.Uintptr: 8,
+}
+
+// gen_methods generates the pair of methods handling a type.
+func (g *generator) gen_methods(i int, t types.Type) error {
+	ts := g.typeString(t)
+	var app, rd bytes.Buffer
+	fmt.Fprintf(&app, "\nfunc (e *%s) append%v(b []byte, v *%s) []byte {\n", g.recv, i, ts)
+	fmt.Fprintf(&rd, "\nfunc (e *%s) read%v(v *%s) error {\n", g.recv, i, ts)
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		k := u.Kind()
+		switch {
+		case k == types.Bool:
+			fmt.Fprintf(&app, "if *v {\nreturn append(b, 0xFF)\n}\nreturn append(b, 0x00)\n")
+			fmt.Fprintf(&rd, "x, err := e.readInteger(1)\nif err != nil {\nreturn err\n}\n*v = x != 0\nreturn nil\n")
+		case k == types.String:
+			fmt.Fprintf(&app, "b = e.appendInteger(b, e.length(len(*v)), 4)\nreturn append(b, *v...)\n")
+			fmt.Fprintf(&rd, "n, err := e.readInteger(4)\nif err != nil {\nreturn err\n}\ns, err := e.readBytes(n)\nif err != nil {\nreturn err\n}\n*v = %s(s)\nreturn nil\n", ts)
+		case k == types.Float32 || k == types.Float64:
+			bits, depth := 32, 4
+			if k == types.Float64 {
+				bits, depth = 64, 8
+			}
+			g.imports["math"] = "math"
+			fmt.Fprintf(&app, "return e.appendInteger(b, uint64(math.Float%vbits(float%v(*v))), %v)\n", bits, bits, depth)
+			fmt.Fprintf(&rd, "x, err := e.readInteger(%v)\nif err != nil {\nreturn err\n}\n*v = %s(math.Float%vfrombits(uint%v(x)))\nreturn nil\n", depth, ts, bits, bits)
+		case k == types.Complex64 || k == types.Complex128:
+			bits, depth := 32, 4
+			if k == types.Complex128 {
+				bits, depth = 64, 8
+			}
+			g.imports["math"] = "math"
+			fmt.Fprintf(&app, "b = e.appendInteger(b, uint64(math.Float%[1]vbits(float%[1]v(real(*v)))), %[2]v)\n", bits, depth)
+			fmt.Fprintf(&app, "return e.appendInteger(b, uint64(math.Float%[1]vbits(float%[1]v(imag(*v)))), %[2]v)\n", bits, depth)
+			fmt.Fprintf(&rd, "x, err := e.readInteger(%v)\nif err != nil {\nreturn err\n}\n", depth)
+			fmt.Fprintf(&rd, "y, err := e.readInteger(%v)\nif err != nil {\nreturn err\n}\n", depth)
+			fmt.Fprintf(&rd, "*v = %s(complex(math.Float%[2]vfrombits(uint%[2]v(x)), math.Float%[2]vfrombits(uint%[2]v(y))))\nreturn nil\n", ts, bits)
+		case integers[k] != 0:
+			depth := integers[k]
+			bits := depth * 8
+			signed := u.Info()&types.IsUnsigned == 0
+			fmt.Fprintf(&rd, "x, err := e.readInteger(%v)\nif err != nil {\nreturn err\n}\n", depth)
+			if signed {
+				// Signed integers are shifted to be positive.
+				fmt.Fprintf(&app, "return e.appendInteger(b, uint64(uint%[1]v(*v)^(1<<%[2]v)), %[3]v)\n", bits, bits-1, depth)
+				fmt.Fprintf(&rd, "y := int%[1]v(uint%[1]v(x) ^ (1 << %[2]v))\n", bits, bits-1)
+			} else {
+				fmt.Fprintf(&app, "return e.appendInteger(b, uint64(*v), %v)\n", depth)
+				fmt.Fprintf(&rd, "y := x\n")
+			}
+			switch k {
+			case types.Int, types.Uint, types.Uintptr:
+				g.imports["fmt"] = "fmt"
+				kind := basicSignatures[k]
+				fmt.Fprintf(&rd, "if %[1]s(%[2]s(y)) != y {\nreturn fmt.Errorf(\"value %%v overflows %[2]s\", y)\n}\n", map[bool]string{true: "int64", false: "uint64"}[signed], kind)
+			}
+			fmt.Fprintf(&rd, "*v = %s(y)\nreturn nil\n", ts)
+		default:
+			return fmt.Errorf("type %s is not supported by read_writer_gen", t)
+		}
+	case *types.Array:
+		m := g.method(u.Elem())
+		fmt.Fprintf(&app, "for i := range v {\nb = e.append%v(b, &v[i])\n}\nreturn b\n", m)
+		fmt.Fprintf(&rd, "for i := range v {\nif err := e.read%v(&v[i]); err != nil {\nreturn err\n}\n}\nreturn nil\n", m)
+	case *types.Slice:
+		m := g.method(u.Elem())
+		fmt.Fprintf(&app, "b = e.appendInteger(b, e.length(len(*v)), 4)\nfor i := range *v {\nb = e.append%v(b, &(*v)[i])\n}\nreturn b\n", m)
+		fmt.Fprintf(&rd, "n, err := e.readInteger(4)\nif err != nil {\nreturn err\n}\nif n == 0xFFFFFFFF {\n// Nil slice\n*v = nil\nreturn nil\n}\ns := make(%s, 0, e.capacity(n, %v))\n", ts, g.sizes.Sizeof(u.Elem()))
+		fmt.Fprintf(&rd, "for i := uint64(0); i < n; i++ {\nvar x %s\nif err := e.read%v(&x); err != nil {\nreturn err\n}\ns = append(s, x)\n}\n*v = s\nreturn nil\n", g.typeString(u.Elem()), m)
+	case *types.Map:
+		km := g.method(u.Key())
+		em := g.method(u.Elem())
+		fmt.Fprintf(&app, "b = e.appendInteger(b, e.length(len(*v)), 4)\nfor k, x := range *v {\nk, x := k, x\nb = e.append%v(b, &k)\nb = e.append%v(b, &x)\n}\nreturn b\n", km, em)
+		fmt.Fprintf(&rd, "n, err := e.readInteger(4)\nif err != nil {\nreturn err\n}\nif n == 0xFFFFFFFF {\n// Nil map\n*v = nil\nreturn nil\n}\nm := make(%s)\n", ts)
+		fmt.Fprintf(&rd, "for i := uint64(0); i < n; i++ {\nvar k %s\nvar x %s\n", g.typeString(u.Key()), g.typeString(u.Elem()))
+		fmt.Fprintf(&rd, "if err := e.read%v(&k); err != nil {\nreturn err\n}\nif err := e.read%v(&x); err != nil {\nreturn err\n}\nm[k] = x\n}\n*v = m\nreturn nil\n", km, em)
+	case *types.Pointer:
+		m := g.method(u.Elem())
+		fmt.Fprintf(&app, "if *v == nil {\nreturn append(b, 0x00)\n}\nreturn e.append%v(append(b, 0xFF), *v)\n", m)
+		fmt.Fprintf(&rd, "x, err := e.readInteger(1)\nif err != nil {\nreturn err\n}\nif x == 0 {\n*v = nil\nreturn nil\n}\n")
+		fmt.Fprintf(&rd, "p := new(%s)\nif err := e.read%v(p); err != nil {\nreturn err\n}\n*v = p\nreturn nil\n", g.typeString(u.Elem()), m)
+	case *types.Struct:
+		fields, err := structFields(u)
+		if err != nil {
+			return err
+		}
+		ids, err := fieldIDs(fields)
+		if err != nil {
+			return err
+		}
+		if ids == nil {
+			for _, f := range fields {
+				m := g.method(f.typ)
+				fmt.Fprintf(&app, "b = e.append%v(b, &v.%s)\n", m, f.name)
+				fmt.Fprintf(&rd, "if err := e.read%v(&v.%s); err != nil {\nreturn err\n}\n", m, f.name)
+			}
+			fmt.Fprintf(&app, "return b\n")
+			fmt.Fprintf(&rd, "return nil\n")
+			break
+		}
+		// Struct with field IDs
+		g.imports["fmt"] = "fmt"
+		fmt.Fprintf(&app, "b = e.appendInteger(b, %v, 4)\nvar start int\n", len(fields))
+		fmt.Fprintf(&rd, "count, err := e.readInteger(4)\nif err != nil {\nreturn err\n}\n")
+		for _, f := range fields {
+			// Fields absent from serialized data are left zeroed.
+			fmt.Fprintf(&rd, "v.%s = *new(%s)\n", f.name, g.typeString(f.typ))
+		}
+		fmt.Fprintf(&rd, "for i := uint64(0); i < count; i++ {\nid, err := e.readInteger(4)\nif err != nil {\nreturn err\n}\n")
+		fmt.Fprintf(&rd, "length, err := e.readInteger(4)\nif err != nil {\nreturn err\n}\nstart, r := e.n, e.r\ne.r = io.LimitReader(r, int64(length))\nswitch id {\n")
+		for j, f := range fields {
+			m := g.method(f.typ)
+			fmt.Fprintf(&app, "b = e.appendInteger(b, %v, 4)\nb = append(b, 0, 0, 0, 0)\nstart = len(b)\nb = e.append%v(b, &v.%s)\n", ids[j], m, f.name)
+			fmt.Fprintf(&app, "e.appendInteger(b[:start-4], e.length(len(b)-start), 4)\n")
+			fmt.Fprintf(&rd, "case %v:\nerr = e.read%v(&v.%s)\n", ids[j], m, f.name)
+		}
+		fmt.Fprintf(&app, "return b\n")
+		fmt.Fprintf(&rd, "default:\n// Field unknown to this struct\nvar n int64\nn, err = io.CopyN(io.Discard, e.r, int64(length))\ne.n += n\n}\ne.r = r\nif err != nil {\nreturn err\n}\n")
+		fmt.Fprintf(&rd, "if e.n-start != int64(length) {\nreturn fmt.Errorf(\"struct field ID %%v: expected %%v bytes, consumed %%v\", id, length, e.n-start)\n}\n}\nreturn nil\n")
+	default:
+		return fmt.Errorf("type %s is not supported by read_writer_gen", t)
+	}
+	fmt.Fprintf(&app, "}\n")
+	fmt.Fprintf(&rd, "}\n")
+	g.body.Write(app.Bytes())
+	g.body.Write(rd.Bytes())
+	return nil
+}
@@ -0,0 +1,59 @@
+// Copyright 2016 Rafael Lorandi <coolparadox@gmail.com>
+// This file is part of Raw, a binary encoder of Go types.
+//
+// Raw is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Raw is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Raw. If not, see <http://www.gnu.org/licenses/>.
+
+package raw
+
+import (
+	"reflect"
+)
+
+// references holds pointed values seen
+// during a single serialization or recovery (see References).
+// Pointed values are identified by the order of their first occurrence.
+type references struct {
+	ids  map[reference]uint32
+	ptrs []reflect.Value
+}
+
+// reference identifies a pointed value during serialization.
+type reference struct {
+	addr uintptr
+	t    reflect.Type
+}
+
+// reset forgets all pointed values.
+func (r *references) reset() {
+	r.ids = make(map[reference]uint32)
+	r.ptrs = r.ptrs[:0]
+}
+
+// id answers the identification of a pointer's value,
+// and whether the value was seen before.
+// Values not seen before are identified and remembered.
+func (r *references) id(ptr reflect.Value) (uint32, bool) {
+	key := reference{ptr.Pointer(), ptr.Type()}
+	if id, ok := r.ids[key]; ok {
+		return id, true
+	}
+	id := uint32(len(r.ids))
+	r.ids[key] = id
+	return id, false
+}
+
+// add remembers a recovered pointer.
+func (r *references) add(ptr reflect.Value) {
+	r.ptrs = append(r.ptrs, ptr)
+}
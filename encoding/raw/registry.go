@@ -0,0 +1,90 @@
+// Copyright 2016 Rafael Lorandi <coolparadox@gmail.com>
+// This file is part of Raw, a binary encoder of Go types.
+//
+// Raw is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Raw is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Raw. If not, see <http://www.gnu.org/licenses/>.
+
+package raw
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// registry maps names to concrete types of interface values
+// and vice-versa (see Register).
+var registry = struct {
+	sync.RWMutex
+	types map[string]reflect.Type
+	names map[reflect.Type]string
+}{
+	types: make(map[string]reflect.Type),
+	names: make(map[reflect.Type]string),
+}
+
+/*
+Register records a concrete type
+that may be held by interface values,
+under a name that identifies it in serialized data.
+
+Parameter prototype is a value of the concrete type,
+which must be supported (see Supported Types).
+Its contents are not relevant.
+As support may depend on Options (eg. IgnoreUnexported),
+the type is verified by each Encoder
+when it first serializes or recovers a value of the type.
+
+A name can be registered only once,
+and a type can be registered under a single name.
+Registering again a type under its own name has no effect.
+*/
+func Register(name string, prototype interface{}) error {
+	if name == "" {
+		return fmt.Errorf("registered name must not be empty")
+	}
+	if prototype == nil {
+		return fmt.Errorf("prototype must not be a nil interface")
+	}
+	t := reflect.TypeOf(prototype)
+	registry.Lock()
+	defer registry.Unlock()
+	if other, ok := registry.types[name]; ok {
+		if other == t {
+			return nil
+		}
+		return fmt.Errorf("name '%s' already registered for type %s", name, other)
+	}
+	if other, ok := registry.names[t]; ok {
+		return fmt.Errorf("type %s already registered as '%s'", t, other)
+	}
+	registry.types[name] = t
+	registry.names[t] = name
+	return nil
+}
+
+// registeredName answers the name of a registered type.
+func registeredName(t reflect.Type) (string, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	name, ok := registry.names[t]
+	return name, ok
+}
+
+// registeredType answers the type registered under a name.
+func registeredType(name string) (reflect.Type, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	t, ok := registry.types[name]
+	return t, ok
+}
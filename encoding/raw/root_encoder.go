@@ -0,0 +1,310 @@
+// Copyright 2016 Rafael Lorandi <coolparadox@gmail.com>
+// This file is part of Raw, a binary encoder of Go types.
+//
+// Raw is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Raw is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Raw. If not, see <http://www.gnu.org/licenses/>.
+
+package raw
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// headerMagic starts the type header of self-describing data.
+const headerMagic = "RAW"
+
+// headerVersion identifies the layout of the type header.
+const headerVersion = 1
+
+// Format flags of the type header,
+// telling which Options affect serialized data.
+const (
+	flagTrackReferences = 1 << iota
+	flagOrdered
+	flagPreserveNil
+	flagVarintLengths
+	flagLengthPrefixed
+)
+
+// lenientFlags are the format flags
+// whose mismatch does not prevent recovery.
+const lenientFlags = flagPreserveNil
+
+// rootEncoder is the Encoder answered by New and NewWithOptions.
+// It wraps the Encoder of the placeholder variable,
+// handles the type header of self-describing data,
+// and keeps the state of streaming by Read and Write.
+type rootEncoder struct {
+	worker Serializer
+	header []byte
+	refs   *references
+
+	// maxBytes limits the bytes consumed by ReadFrom (see Limits).
+	maxBytes int64
+
+	// reading tells if a sequence is being streamed by Read,
+	// whose pending bytes are in rbuf.
+	reading bool
+	rbuf    bytes.Buffer
+
+	// writing is the recovery of an incomplete sequence
+	// fed by Write, or nil.
+	writing *writeStream
+}
+
+// FormatFlags answers the format flags corresponding to Options,
+// as recorded in type headers of self-describing data
+// (see Self-describing Data).
+// Applications storing data serialized with Options
+// may record them as well (see CompatibleFlags).
+func FormatFlags(o Options) byte {
+	var flags byte
+	if o.TrackReferences {
+		flags |= flagTrackReferences
+	}
+	if o.Ordered {
+		flags |= flagOrdered
+	}
+	if o.PreserveNil {
+		flags |= flagPreserveNil
+	}
+	if o.VarintLengths {
+		flags |= flagVarintLengths
+	}
+	if o.LengthPrefixed {
+		flags |= flagLengthPrefixed
+	}
+	return flags
+}
+
+// CompatibleFlags verifies if data serialized with format flags written
+// can be recovered by an Encoder with format flags reading
+// (see FormatFlags).
+func CompatibleFlags(written, reading byte) error {
+	if written&^lenientFlags != reading&^lenientFlags {
+		return fmt.Errorf("format flags mismatch: expected %#x, found %#x", reading, written)
+	}
+	return nil
+}
+
+// makeHeader creates the type header of self-describing data.
+//
+// The header is composed of headerMagic, headerVersion,
+// a byte of format flags
+// and the signature serialized as a string.
+func makeHeader(signature string, flags byte) []byte {
+	b := new(bytes.Buffer)
+	b.WriteString(headerMagic)
+	b.WriteByte(headerVersion)
+	b.WriteByte(flags)
+	stringEncoder{store: &signature}.WriteTo(b)
+	return b.Bytes()
+}
+
+// readHeader reads a type header
+// and verifies it against the header of the Encoder.
+// Returns the number of bytes read.
+func (e *rootEncoder) readHeader(r io.Reader) (int64, error) {
+	var nc int64
+	prefix := make([]byte, len(headerMagic)+2)
+	n, err := io.ReadFull(r, prefix)
+	nc += int64(n)
+	if err != nil {
+		return nc, err
+	}
+	if string(prefix[:len(headerMagic)]) != headerMagic {
+		return nc, BadHeaderError
+	}
+	if prefix[len(headerMagic)] != headerVersion {
+		return nc, fmt.Errorf("%w: unknown version %v", BadHeaderError, prefix[len(headerMagic)])
+	}
+	flags := e.header[len(headerMagic)+1]
+	err = CompatibleFlags(prefix[len(headerMagic)+1], flags)
+	if err != nil {
+		return nc, fmt.Errorf("%w: %s", BadHeaderError, err)
+	}
+	var signature string
+	n64, err := stringEncoder{store: &signature}.ReadFrom(r)
+	nc += n64
+	if err != nil {
+		return nc, err
+	}
+	if signature != e.Signature() {
+		return nc, fmt.Errorf("%w: expected '%s', found '%s'", SignatureMismatchError, e.Signature(), signature)
+	}
+	return nc, nil
+}
+
+func (e *rootEncoder) Signature() string {
+	return e.worker.Signature()
+}
+
+func (e *rootEncoder) WriteTo(w io.Writer) (int64, error) {
+	var nc int64
+	e.abandonWrite()
+	if e.refs != nil {
+		e.refs.reset()
+	}
+	if e.header != nil {
+		n, err := w.Write(e.header)
+		nc += int64(n)
+		if err != nil {
+			return nc, err
+		}
+	}
+	n, err := e.worker.WriteTo(w)
+	nc += n
+	return nc, err
+}
+
+func (e *rootEncoder) ReadFrom(r io.Reader) (int64, error) {
+	e.abandonWrite()
+	return e.readFrom(r)
+}
+
+// readFrom is ReadFrom without abandoning
+// the recovery of a sequence fed by Write,
+// which is performed by readFrom itself.
+func (e *rootEncoder) readFrom(r io.Reader) (int64, error) {
+	var nc int64
+	if e.maxBytes > 0 {
+		r = &byteLimitReader{r: r, max: e.maxBytes, remaining: e.maxBytes}
+	}
+	if e.refs != nil {
+		e.refs.reset()
+	}
+	if e.header != nil {
+		n, err := e.readHeader(r)
+		nc += n
+		if err != nil {
+			return nc, truncated(err, nc)
+		}
+	}
+	n, err := e.worker.ReadFrom(r)
+	nc += n
+	if err != nil {
+		if nc == 0 && errors.Is(err, io.EOF) {
+			// A clean end of data is reported as is.
+			return nc, io.EOF
+		}
+		return nc, truncated(decodeError(err, "", nc-n, e.worker.Signature()), nc)
+	}
+	return nc, nil
+}
+
+func (e *rootEncoder) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if !e.reading {
+		e.rbuf.Reset()
+		_, err := e.WriteTo(&e.rbuf)
+		if err != nil {
+			return 0, err
+		}
+		e.reading = true
+	}
+	if e.rbuf.Len() == 0 {
+		e.reading = false
+		return 0, io.EOF
+	}
+	return e.rbuf.Read(p)
+}
+
+func (e *rootEncoder) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	s := e.writing
+	if s == nil {
+		s = &writeStream{chunk: p, chunks: make(chan []byte), more: make(chan struct{}), done: make(chan error, 1)}
+		e.writing = s
+		go func() {
+			_, err := e.readFrom(s)
+			s.done <- err
+		}()
+	} else {
+		s.chunks <- p
+	}
+	select {
+	case <-s.more:
+		// Incomplete sequence; wait for more bytes.
+		return len(p), nil
+	case err := <-s.done:
+		e.writing = nil
+		n := len(p) - len(s.chunk)
+		if err != nil {
+			return n, err
+		}
+		if n < len(p) {
+			return n, fmt.Errorf("%w: %v bytes", TrailingDataError, len(p)-n)
+		}
+		return n, nil
+	}
+}
+
+// abandonWrite stops the recovery of an incomplete sequence fed by Write,
+// if any, as if its data ended.
+func (e *rootEncoder) abandonWrite() {
+	if e.writing == nil {
+		return
+	}
+	close(e.writing.chunks)
+	<-e.writing.done
+	e.writing = nil
+}
+
+// writeStream is the reader of the recovery of a sequence
+// fed by successive calls of Write.
+// Recovery runs in its own goroutine,
+// which waits for the next call of Write
+// whenever the bytes of the current one are exhausted,
+// so that each call resumes recovery where the previous one stopped.
+// Handoffs through channels keep the goroutine and the caller of Write
+// from running at the same time.
+type writeStream struct {
+
+	// chunk holds the bytes of the current call of Write not read yet.
+	chunk []byte
+
+	// chunks hands the bytes of the next call of Write to the goroutine,
+	// and is closed if the sequence is abandoned.
+	chunks chan []byte
+
+	// more tells that chunk is exhausted and recovery awaits more bytes.
+	more chan struct{}
+
+	// done answers the result of recovery.
+	done chan error
+}
+
+func (s *writeStream) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for len(s.chunk) == 0 {
+		s.chunk = nil
+		s.more <- struct{}{}
+		chunk, ok := <-s.chunks
+		if !ok {
+			return 0, io.ErrUnexpectedEOF
+		}
+		s.chunk = chunk
+	}
+	n := copy(p, s.chunk)
+	s.chunk = s.chunk[n:]
+	return n, nil
+}
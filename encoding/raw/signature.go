@@ -0,0 +1,571 @@
+// Copyright 2016 Rafael Lorandi <coolparadox@gmail.com>
+// This file is part of Raw, a binary encoder of Go types.
+//
+// Raw is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Raw is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Raw. If not, see <http://www.gnu.org/licenses/>.
+
+package raw
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Kind tells the nature of a type described by a Signature.
+type Kind int
+
+const (
+	// BasicKind describes booleans, numbers and strings.
+	BasicKind Kind = iota
+
+	// BuiltinKind describes types with built-in support
+	// (see Time and Big Numbers).
+	BuiltinKind
+
+	// InterfaceKind describes interfaces (see Interfaces).
+	InterfaceKind
+
+	// ArrayKind describes arrays.
+	ArrayKind
+
+	// SliceKind describes slices.
+	SliceKind
+
+	// PointerKind describes pointers.
+	PointerKind
+
+	// MapKind describes maps.
+	MapKind
+
+	// StructKind describes structs.
+	StructKind
+
+	// RecursiveKind describes a reference to an enclosing type
+	// (see Recursive Types).
+	RecursiveKind
+
+	// MarshalerKind describes types that serialize themselves
+	// by implementing Marshaler and Unmarshaler
+	// (see Custom Serialization).
+	MarshalerKind
+
+	// BinaryMarshalerKind describes types that serialize themselves
+	// by implementing encoding.BinaryMarshaler and encoding.BinaryUnmarshaler
+	// (see Custom Serialization).
+	BinaryMarshalerKind
+)
+
+// Signature is a structured description of a type signature
+// (see ParseSignature).
+type Signature struct {
+	Kind Kind
+
+	// Name is the name of basic kinds (eg. "int64")
+	// and of types with built-in support (eg. "time.Time"),
+	// or the type name of types that serialize themselves
+	// (eg. "big.Float" in "raw(big.Float)").
+	Name string
+
+	// Len is the length of arrays.
+	Len int
+
+	// Up is the number of levels above the enclosing type
+	// referred by recursive references (eg. 2 in "^2").
+	Up int
+
+	// Key describes the key of maps.
+	Key *Signature
+
+	// Elem describes the elements of arrays, slices and maps,
+	// and the pointed values of pointers.
+	Elem *Signature
+
+	// Fields describes the fields of structs.
+	Fields []Field
+
+	// Tagged tells if struct fields have IDs (see Struct Tags).
+	Tagged bool
+}
+
+// Field describes a field of a struct.
+type Field struct {
+
+	// ID is the field ID, or zero if the struct has no field IDs.
+	ID uint32
+
+	// Type describes the type of the field.
+	Type *Signature
+}
+
+// basicNames are the signatures of basic kinds.
+var basicNames = []string{
+	"bool",
+	"int", "int8", "int16", "int32", "int64",
+	"uint", "uint8", "uint16", "uint32", "uint64", "uintptr",
+	"float32", "float64",
+	"complex64", "complex128",
+	"string",
+}
+
+// builtinNames are the signatures of types with built-in support.
+var builtinNames = []string{
+	"time.Time", "time.Duration",
+	"big.Int", "big.Float", "big.Rat",
+}
+
+// String answers the type signature described by s,
+// as answered by the Signature method of Encoders.
+func (s *Signature) String() string {
+	switch s.Kind {
+	case InterfaceKind:
+		return "interface"
+	case ArrayKind:
+		return "[" + strconv.Itoa(s.Len) + "]" + s.Elem.String()
+	case SliceKind:
+		return "[]" + s.Elem.String()
+	case PointerKind:
+		return "*" + s.Elem.String()
+	case MapKind:
+		return "map[" + s.Key.String() + "]" + s.Elem.String()
+	case StructKind:
+		ans := "struct {"
+		for i, f := range s.Fields {
+			if i > 0 {
+				ans += ";"
+			}
+			ans += " "
+			if s.Tagged {
+				ans += strconv.FormatUint(uint64(f.ID), 10) + ":"
+			}
+			ans += f.Type.String()
+		}
+		return ans + " }"
+	case RecursiveKind:
+		return "^" + strconv.Itoa(s.Up)
+	case MarshalerKind:
+		return "raw(" + s.Name + ")"
+	case BinaryMarshalerKind:
+		return "binary(" + s.Name + ")"
+	}
+	return s.Name
+}
+
+/*
+ParseSignature parses a type signature,
+as answered by the Signature method of Encoders.
+
+Returns a structured description of the signature.
+*/
+func ParseSignature(signature string) (*Signature, error) {
+	p := &signatureParser{text: signature}
+	s, err := p.parse(0)
+	if err == nil {
+		p.skipSpaces()
+		if p.pos < len(p.text) {
+			err = p.errorf("unexpected '%s'", p.text[p.pos:])
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature '%s': %s", signature, err)
+	}
+	return s, nil
+}
+
+// signatureParser holds the state of the parsing of a type signature.
+type signatureParser struct {
+	text string
+	pos  int
+}
+
+func (p *signatureParser) errorf(format string, a ...interface{}) error {
+	return fmt.Errorf("at offset %v: %s", p.pos, fmt.Sprintf(format, a...))
+}
+
+func (p *signatureParser) skipSpaces() {
+	for p.pos < len(p.text) && p.text[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// consume skips a given token if it comes next.
+// Returns true if the token was skipped.
+func (p *signatureParser) consume(token string) bool {
+	p.skipSpaces()
+	if !strings.HasPrefix(p.text[p.pos:], token) {
+		return false
+	}
+	p.pos += len(token)
+	return true
+}
+
+// expect skips a given token, failing if it does not come next.
+func (p *signatureParser) expect(token string) error {
+	if !p.consume(token) {
+		return p.errorf("expected '%s'", token)
+	}
+	return nil
+}
+
+// number parses a decimal number.
+func (p *signatureParser) number() (uint64, error) {
+	p.skipSpaces()
+	start := p.pos
+	for p.pos < len(p.text) && p.text[p.pos] >= '0' && p.text[p.pos] <= '9' {
+		p.pos++
+	}
+	if start == p.pos {
+		return 0, p.errorf("expected a number")
+	}
+	return strconv.ParseUint(p.text[start:p.pos], 10, 32)
+}
+
+// word parses a name of basic kinds, built-in types or keywords.
+func (p *signatureParser) word() string {
+	p.skipSpaces()
+	start := p.pos
+	for p.pos < len(p.text) {
+		c := p.text[p.pos]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.') {
+			break
+		}
+		p.pos++
+	}
+	return p.text[start:p.pos]
+}
+
+// typeName parses the type name of types that serialize themselves,
+// up to the closing parenthesis.
+func (p *signatureParser) typeName() (string, error) {
+	start := p.pos
+	for depth := 0; p.pos < len(p.text); p.pos++ {
+		switch p.text[p.pos] {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				if start == p.pos {
+					return "", p.errorf("expected a type name")
+				}
+				name := p.text[start:p.pos]
+				p.pos++
+				return name, nil
+			}
+			depth--
+		}
+	}
+	return "", p.errorf("expected ')'")
+}
+
+// parse parses a type.
+// Parameter depth is the number of enclosing types.
+func (p *signatureParser) parse(depth int) (*Signature, error) {
+	p.skipSpaces()
+	switch {
+	case p.consume("^"):
+		up, err := p.number()
+		if err != nil {
+			return nil, err
+		}
+		if up == 0 || int(up) > depth {
+			return nil, p.errorf("recursive reference ^%v beyond enclosing types", up)
+		}
+		return &Signature{Kind: RecursiveKind, Up: int(up)}, nil
+	case p.consume("[]"):
+		elem, err := p.parse(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return &Signature{Kind: SliceKind, Elem: elem}, nil
+	case p.consume("["):
+		n, err := p.number()
+		if err != nil {
+			return nil, err
+		}
+		err = p.expect("]")
+		if err != nil {
+			return nil, err
+		}
+		elem, err := p.parse(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return &Signature{Kind: ArrayKind, Len: int(n), Elem: elem}, nil
+	case p.consume("*"):
+		elem, err := p.parse(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return &Signature{Kind: PointerKind, Elem: elem}, nil
+	}
+	start := p.pos
+	word := p.word()
+	switch word {
+	case "interface":
+		return &Signature{Kind: InterfaceKind}, nil
+	case "map":
+		err := p.expect("[")
+		if err != nil {
+			return nil, err
+		}
+		key, err := p.parse(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		err = p.expect("]")
+		if err != nil {
+			return nil, err
+		}
+		elem, err := p.parse(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return &Signature{Kind: MapKind, Key: key, Elem: elem}, nil
+	case "struct":
+		return p.parseStruct(depth)
+	case "raw", "binary":
+		err := p.expect("(")
+		if err != nil {
+			return nil, err
+		}
+		name, err := p.typeName()
+		if err != nil {
+			return nil, err
+		}
+		if word == "binary" {
+			return &Signature{Kind: BinaryMarshalerKind, Name: name}, nil
+		}
+		return &Signature{Kind: MarshalerKind, Name: name}, nil
+	}
+	for _, name := range basicNames {
+		if word == name {
+			return &Signature{Kind: BasicKind, Name: name}, nil
+		}
+	}
+	for _, name := range builtinNames {
+		if word == name {
+			return &Signature{Kind: BuiltinKind, Name: name}, nil
+		}
+	}
+	p.pos = start
+	if word == "" {
+		return nil, p.errorf("expected a type")
+	}
+	return nil, p.errorf("unknown type '%s'", word)
+}
+
+// parseStruct parses the fields of a struct.
+// Parameter depth is the number of enclosing types.
+func (p *signatureParser) parseStruct(depth int) (*Signature, error) {
+	err := p.expect("{")
+	if err != nil {
+		return nil, err
+	}
+	s := &Signature{Kind: StructKind}
+	if p.consume("}") {
+		return s, nil
+	}
+	for i := 0; ; i++ {
+		var id uint64
+		p.skipSpaces()
+		start := p.pos
+		if p.pos < len(p.text) && p.text[p.pos] >= '0' && p.text[p.pos] <= '9' {
+			id, err = p.number()
+			if err != nil {
+				return nil, err
+			}
+			err = p.expect(":")
+			if err != nil {
+				return nil, err
+			}
+			if id == 0 {
+				return nil, p.errorf("invalid field ID 0")
+			}
+		}
+		if i == 0 {
+			s.Tagged = id != 0
+		} else if s.Tagged != (id != 0) {
+			p.pos = start
+			return nil, p.errorf("struct has fields both with and without field IDs")
+		}
+		for _, f := range s.Fields {
+			if id != 0 && f.ID == uint32(id) {
+				p.pos = start
+				return nil, p.errorf("duplicate field ID %v", id)
+			}
+		}
+		t, err := p.parse(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		s.Fields = append(s.Fields, Field{ID: uint32(id), Type: t})
+		if p.consume("}") {
+			return s, nil
+		}
+		err = p.expect(";")
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+/*
+Compatible verifies if serialized data of a type signature
+can be recovered by an Encoder of another type signature.
+
+Parameter written is the signature of the Encoder that serialized data.
+Parameter reading is the signature of the Encoder that recovers data.
+
+Signatures are compatible if they are equal, or if they differ only in that:
+
+  - int, int64 and time.Duration are interchangeable,
+    as are uint, uint64 and uintptr;
+  - structs with field IDs have fields whose IDs are unknown to the other
+    (see Struct Tags).
+
+Returns nil if signatures are compatible,
+or an error wrapping SignatureMismatchError that tells why not.
+*/
+func Compatible(written, reading string) error {
+	w, err := ParseSignature(written)
+	if err != nil {
+		return err
+	}
+	r, err := ParseSignature(reading)
+	if err != nil {
+		return err
+	}
+	c := compatibility{seen: make(map[[2]*Signature]bool)}
+	err = c.check(w, r, nil, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %s", SignatureMismatchError, err)
+	}
+	return nil
+}
+
+// compatibility holds the state of the verification
+// of compatibility of signatures.
+type compatibility struct {
+
+	// seen holds the pairs of types under verification,
+	// so that recursive types are verified only once.
+	seen map[[2]*Signature]bool
+}
+
+// resolve answers the type referred by a recursive reference
+// and its enclosing types.
+func resolve(s *Signature, stack []*Signature) (*Signature, []*Signature) {
+	for s.Kind == RecursiveKind {
+		i := len(stack) - s.Up
+		s, stack = stack[i], stack[:i]
+	}
+	return s, stack
+}
+
+// encodedName answers the name of basic and built-in types,
+// unifying those with the same serialized form.
+func encodedName(s *Signature) string {
+	switch s.Name {
+	case "int", "time.Duration":
+		return "int64"
+	case "uint", "uintptr":
+		return "uint64"
+	}
+	return s.Name
+}
+
+// check verifies the compatibility of a written type w
+// with a reading type r,
+// whose enclosing types are in ws and rs.
+func (c compatibility) check(w, r *Signature, ws, rs []*Signature) error {
+	w, ws = resolve(w, ws)
+	r, rs = resolve(r, rs)
+	pair := [2]*Signature{w, r}
+	if c.seen[pair] {
+		return nil
+	}
+	c.seen[pair] = true
+	mismatch := fmt.Errorf("found '%s', expected '%s'", w, r)
+	if w.Kind == BasicKind || w.Kind == BuiltinKind {
+		if (r.Kind == BasicKind || r.Kind == BuiltinKind) && encodedName(w) == encodedName(r) {
+			return nil
+		}
+		return mismatch
+	}
+	if w.Kind != r.Kind {
+		return mismatch
+	}
+	ws = append(ws[:len(ws):len(ws)], w)
+	rs = append(rs[:len(rs):len(rs)], r)
+	switch w.Kind {
+	case ArrayKind:
+		if w.Len != r.Len {
+			return mismatch
+		}
+		err := c.check(w.Elem, r.Elem, ws, rs)
+		if err != nil {
+			return fmt.Errorf("array element: %s", err)
+		}
+	case SliceKind:
+		err := c.check(w.Elem, r.Elem, ws, rs)
+		if err != nil {
+			return fmt.Errorf("slice element: %s", err)
+		}
+	case PointerKind:
+		err := c.check(w.Elem, r.Elem, ws, rs)
+		if err != nil {
+			return fmt.Errorf("pointed value: %s", err)
+		}
+	case MapKind:
+		err := c.check(w.Key, r.Key, ws, rs)
+		if err != nil {
+			return fmt.Errorf("map key: %s", err)
+		}
+		err = c.check(w.Elem, r.Elem, ws, rs)
+		if err != nil {
+			return fmt.Errorf("map element: %s", err)
+		}
+	case StructKind:
+		if w.Tagged != r.Tagged {
+			return mismatch
+		}
+		if !w.Tagged {
+			if len(w.Fields) != len(r.Fields) {
+				return fmt.Errorf("found %v struct fields, expected %v", len(w.Fields), len(r.Fields))
+			}
+			for i := range w.Fields {
+				err := c.check(w.Fields[i].Type, r.Fields[i].Type, ws, rs)
+				if err != nil {
+					return fmt.Errorf("struct field %v: %s", i, err)
+				}
+			}
+			break
+		}
+		for _, wf := range w.Fields {
+			for _, rf := range r.Fields {
+				if wf.ID != rf.ID {
+					continue
+				}
+				err := c.check(wf.Type, rf.Type, ws, rs)
+				if err != nil {
+					return fmt.Errorf("struct field ID %v: %s", wf.ID, err)
+				}
+			}
+		}
+	case MarshalerKind, BinaryMarshalerKind:
+		if w.Name != r.Name {
+			return mismatch
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+// Copyright 2016 Rafael Lorandi <coolparadox@gmail.com>
+// This file is part of Raw, a binary encoder of Go types.
+//
+// Raw is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Raw is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Raw. If not, see <http://www.gnu.org/licenses/>.
+
+package raw
+
+import (
+	"io"
+	"reflect"
+)
+
+// skipEncoder stands for a struct field not selected by a projection
+// (see Projections).
+// Serialization is delegated to the worker Encoder of the field,
+// while recovery skips serialized data and leaves the field zeroed.
+type skipEncoder struct {
+	worker  Encoder
+	store   reflect.Value
+	options Options
+}
+
+func (e skipEncoder) Signature() string {
+	return e.worker.Signature()
+}
+
+func (e skipEncoder) WriteTo(w io.Writer) (int64, error) {
+	return e.worker.WriteTo(w)
+}
+
+func (e skipEncoder) ReadFrom(r io.Reader) (int64, error) {
+	storeVal := e.store.Elem()
+	defer storeVal.Set(reflect.Zero(storeVal.Type()))
+	if skippable(storeVal.Type(), e.options) {
+		return skip(r, storeVal.Type(), e.options)
+	}
+	// Data must be parsed to be skipped.
+	return e.worker.ReadFrom(r)
+}
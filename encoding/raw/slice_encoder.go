@@ -16,24 +16,41 @@
 
 package raw
 
+import "fmt"
 import "io"
 import "reflect"
+import "strconv"
 
 type sliceEncoder struct {
 	store       reflect.Value
 	worker      Encoder
 	workerStore reflect.Value
+	ordered     bool
+	max         int
+	reuse       bool
+	preserveNil bool
+	varint      bool
 }
 
+// nilLength is the length of nil slices and maps
+// (see Nil Slices and Maps).
+const nilLength = 0xFFFFFFFF
+
 func (e sliceEncoder) Signature() string {
 	return "[]" + e.worker.Signature()
 }
 
 func (e sliceEncoder) WriteTo(w io.Writer) (int64, error) {
+	if e.ordered {
+		return e.writeOrdered(w)
+	}
 	var nc int64
 	storeVal := e.store.Elem()
+	if e.preserveNil && storeVal.IsNil() {
+		return marshalNilLength(e.varint, w)
+	}
 	storeLen := storeVal.Len()
-	n, err := marshalInteger(uint64(storeLen), 4, w)
+	n, err := marshalLength(storeLen, e.varint, w)
 	nc += n
 	if err != nil {
 		return nc, err
@@ -44,30 +61,130 @@ func (e sliceEncoder) WriteTo(w io.Writer) (int64, error) {
 		n, err := e.worker.WriteTo(w)
 		nc += n
 		if err != nil {
-			return nc, err
+			return nc, prependPath(err, "["+strconv.Itoa(i)+"]")
 		}
 	}
 	return nc, nil
 }
 
 func (e sliceEncoder) ReadFrom(r io.Reader) (int64, error) {
+	if e.ordered {
+		return e.readOrdered(r)
+	}
 	var nc int64
-	v, n, err := unmarshalInteger(r, 4)
+	v, n, err := unmarshalLength(r, e.varint)
 	nc += n
 	if err != nil {
 		return nc, err
 	}
+	if v == lengthOfNil {
+		e.store.Elem().Set(reflect.Zero(e.store.Elem().Type()))
+		return nc, nil
+	}
+	err = checkLimit("MaxElements", e.max, v)
+	if err != nil {
+		return nc, err
+	}
 	storeLen := int(v)
-	storeVal := reflect.MakeSlice(e.store.Elem().Type(), storeLen, storeLen)
-	e.store.Elem().Set(storeVal)
+	storeType := e.store.Elem().Type()
+	var storeVal reflect.Value
+	if e.reuse && e.store.Elem().Cap() >= storeLen {
+		storeVal = e.store.Elem().Slice(0, storeLen)
+	} else {
+		storeVal = reflect.MakeSlice(storeType, 0, preallocLen(v, storeType.Elem().Size()))
+	}
 	workerVal := e.workerStore.Elem()
+	zero := reflect.Zero(workerVal.Type())
 	for i := 0; i < storeLen; i++ {
+		if e.reuse && i < storeVal.Len() {
+			workerVal.Set(storeVal.Index(i))
+		} else if e.reuse {
+			// Elements must not share allocations.
+			workerVal.Set(zero)
+		}
 		n, err := e.worker.ReadFrom(r)
 		nc += n
+		if err != nil {
+			return nc, decodeError(err, "["+strconv.Itoa(i)+"]", nc-n, e.worker.Signature())
+		}
+		if i < storeVal.Len() {
+			storeVal.Index(i).Set(workerVal)
+		} else {
+			storeVal = reflect.Append(storeVal, workerVal)
+		}
+	}
+	e.store.Elem().Set(storeVal)
+	return nc, nil
+}
+
+// Markers of slice elements in ordered format (see Ordered Data).
+const (
+	orderedSliceEnd  = 0x00
+	orderedSliceElem = 0x01
+)
+
+// writeOrdered serializes a slice in ordered format.
+func (e sliceEncoder) writeOrdered(w io.Writer) (int64, error) {
+	var nc int64
+	storeVal := e.store.Elem()
+	storeLen := storeVal.Len()
+	workerVal := e.workerStore.Elem()
+	for i := 0; i < storeLen; i++ {
+		n, err := marshalInteger(orderedSliceElem, 1, w)
+		nc += n
+		if err != nil {
+			return nc, err
+		}
+		workerVal.Set(storeVal.Index(i))
+		n, err = e.worker.WriteTo(w)
+		nc += n
+		if err != nil {
+			return nc, prependPath(err, "["+strconv.Itoa(i)+"]")
+		}
+	}
+	n, err := marshalInteger(orderedSliceEnd, 1, w)
+	nc += n
+	return nc, err
+}
+
+// readOrdered recovers a slice in ordered format.
+func (e sliceEncoder) readOrdered(r io.Reader) (int64, error) {
+	var nc int64
+	storeVal := reflect.MakeSlice(e.store.Elem().Type(), 0, 0)
+	if e.reuse {
+		storeVal = e.store.Elem().Slice(0, 0)
+	}
+	workerVal := e.workerStore.Elem()
+	zero := reflect.Zero(workerVal.Type())
+	for i := 0; ; i++ {
+		v, n, err := unmarshalInteger(r, 1)
+		nc += n
 		if err != nil {
 			return nc, err
 		}
-		storeVal.Index(i).Set(workerVal)
+		if v == orderedSliceEnd {
+			break
+		}
+		if v != orderedSliceElem {
+			return nc, fmt.Errorf("invalid slice element marker %#x", v)
+		}
+		err = checkLimit("MaxElements", e.max, uint64(i)+1)
+		if err != nil {
+			return nc, err
+		}
+		if e.reuse && i < storeVal.Cap() {
+			workerVal.Set(storeVal.Slice(0, i+1).Index(i))
+		} else if e.reuse {
+			// Elements must not share allocations.
+			workerVal.Set(zero)
+		}
+		n, err = e.worker.ReadFrom(r)
+		nc += n
+		if err != nil {
+			return nc, decodeError(err, "["+strconv.Itoa(i)+"]", nc-n, e.worker.Signature())
+		}
+		storeVal = reflect.Append(storeVal, workerVal)
 	}
+	e.store.Elem().Set(storeVal)
 	return nc, nil
 }
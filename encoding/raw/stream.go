@@ -0,0 +1,212 @@
+// Copyright 2016 Rafael Lorandi <coolparadox@gmail.com>
+// This file is part of Raw, a binary encoder of Go types.
+//
+// Raw is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Raw is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Raw. If not, see <http://www.gnu.org/licenses/>.
+
+package raw
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// recordMarker starts the header of each record of a stream,
+// for resynchronization after corrupt data (see Record Streams).
+var recordMarker = []byte{0xE2, 'R', 'W', 0x9C}
+
+// recordHeaderLen is the length of the header of a record:
+// the marker, the length and the checksum of the payload,
+// and the checksum of the header itself.
+const recordHeaderLen = 16
+
+// castagnoli is the CRC32C table for checksums of records.
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// StreamWriter writes the placeholder variable of an Encoder
+// as framed records of a stream (see Record Streams).
+type StreamWriter struct {
+	w       io.Writer
+	encoder Encoder
+	buf     bytes.Buffer
+}
+
+// NewStreamWriter creates a StreamWriter
+// that writes records to w
+// serialized by a given Encoder.
+func NewStreamWriter(w io.Writer, e Encoder) *StreamWriter {
+	return &StreamWriter{w: w, encoder: e}
+}
+
+// WriteRecord serializes the placeholder variable of the Encoder
+// and writes it as a record, in a single call to Write of the stream.
+func (s *StreamWriter) WriteRecord() error {
+	s.buf.Reset()
+	s.buf.Write(make([]byte, recordHeaderLen))
+	_, err := s.encoder.WriteTo(&s.buf)
+	if err != nil {
+		return err
+	}
+	b := s.buf.Bytes()
+	length := len(b) - recordHeaderLen
+	if uint64(length) > maxFixedLength {
+		return fmt.Errorf("%w: record of %v bytes", LengthOverflowError, length)
+	}
+	header := b[:0]
+	header = append(header, recordMarker...)
+	header = appendUint32(header, uint32(length))
+	header = appendUint32(header, crc32.Checksum(b[recordHeaderLen:], castagnoli))
+	appendUint32(header, crc32.Checksum(header, castagnoli))
+	_, err = s.w.Write(b)
+	return err
+}
+
+// StreamReader reads framed records of a stream
+// into the placeholder variable of an Encoder
+// (see Record Streams).
+type StreamReader struct {
+	r       *bufio.Reader
+	encoder Encoder
+
+	// src is the source of r,
+	// preceded by data given back after a corrupt payload.
+	src io.Reader
+
+	// resync tells if the reader is looking for the next record marker
+	// after corrupt data.
+	resync bool
+}
+
+// NewStreamReader creates a StreamReader
+// that reads records from r
+// and recovers them by a given Encoder.
+func NewStreamReader(r io.Reader, e Encoder) *StreamReader {
+	return &StreamReader{r: bufio.NewReader(r), encoder: e, src: r}
+}
+
+/*
+Next reads the next record of the stream
+and recovers it into the placeholder variable of the Encoder.
+
+Returns io.EOF at the end of the stream,
+and io.ErrUnexpectedEOF if the stream ends within a record.
+
+If the record is corrupt, returns CorruptRecordError;
+the next call then skips data
+up to the next record whose header is intact,
+looking for it from the byte following the start of the corrupt record,
+so that a record swallowed by a truncated one is not lost.
+
+A record with no data is recovered as such;
+if the Encoder requires data,
+the error wraps io.ErrUnexpectedEOF
+and the stream goes on.
+*/
+func (s *StreamReader) Next() error {
+	if s.resync {
+		err := s.skipToMarker()
+		if err != nil {
+			return err
+		}
+	}
+	header, err := s.r.Peek(recordHeaderLen)
+	if err != nil {
+		if err == io.EOF && len(header) > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	if !bytes.Equal(header[:len(recordMarker)], recordMarker) {
+		return s.corrupt("missing record marker")
+	}
+	if crc32.Checksum(header[:12], castagnoli) != readUint32(header[12:]) {
+		return s.corrupt("header checksum mismatch")
+	}
+	length := uint64(readUint32(header[4:]))
+	checksum := readUint32(header[8:])
+	header = append([]byte(nil), header...)
+	s.r.Discard(recordHeaderLen)
+	payload, _, err := readBytes(s.r, length)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	if crc32.Checksum(payload, castagnoli) != checksum {
+		s.giveBack(append(header[1:], payload...))
+		s.resync = true
+		return fmt.Errorf("%w: payload checksum mismatch", CorruptRecordError)
+	}
+	n, err := s.encoder.ReadFrom(bytes.NewReader(payload))
+	if err != nil {
+		if err == io.EOF {
+			// The record has no data, which is not the end of the stream.
+			err = fmt.Errorf("record of no data: %w", io.ErrUnexpectedEOF)
+		}
+		return err
+	}
+	if uint64(n) != length {
+		return fmt.Errorf("record of %v bytes has %v trailing bytes", length, length-uint64(n))
+	}
+	return nil
+}
+
+// corrupt skips the first byte of a corrupt record header
+// and answers CorruptRecordError.
+func (s *StreamReader) corrupt(reason string) error {
+	s.r.Discard(1)
+	s.resync = true
+	return fmt.Errorf("%w: %s", CorruptRecordError, reason)
+}
+
+// giveBack makes data already consumed
+// be read again before the remaining data of the stream.
+func (s *StreamReader) giveBack(data []byte) {
+	buffered, _ := s.r.Peek(s.r.Buffered())
+	data = append(data, buffered...)
+	s.src = io.MultiReader(bytes.NewReader(data), s.src)
+	s.r.Reset(s.src)
+}
+
+// skipToMarker skips data up to the next record marker.
+func (s *StreamReader) skipToMarker() error {
+	for {
+		b, err := s.r.Peek(len(recordMarker))
+		if err != nil {
+			if err == io.EOF && len(b) > 0 {
+				s.r.Discard(len(b))
+			}
+			return err
+		}
+		if bytes.Equal(b, recordMarker) {
+			s.resync = false
+			return nil
+		}
+		s.r.Discard(1)
+	}
+}
+
+// appendUint32 appends a 4 octet unsigned integer number.
+func appendUint32(b []byte, value uint32) []byte {
+	return append(b, byte(value), byte(value>>8), byte(value>>16), byte(value>>24))
+}
+
+// readUint32 answers the 4 octet unsigned integer number
+// at the start of a byte slice.
+func readUint32(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+}
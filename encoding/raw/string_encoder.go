@@ -18,7 +18,11 @@ package raw
 
 import "io"
 
-type stringEncoder struct{ store *string }
+type stringEncoder struct {
+	store  *string
+	max    int
+	varint bool
+}
 
 func (stringEncoder) Signature() string {
 	return "string"
@@ -27,7 +31,7 @@ func (stringEncoder) Signature() string {
 func (e stringEncoder) WriteTo(w io.Writer) (int64, error) {
 	var nc int64
 	storeLen := len(*e.store)
-	n, err := marshalInteger(uint64(storeLen), 4, w)
+	n, err := marshalLength(storeLen, e.varint, w)
 	nc += n
 	if err != nil {
 		return nc, err
@@ -44,20 +48,19 @@ func (e stringEncoder) WriteTo(w io.Writer) (int64, error) {
 
 func (e stringEncoder) ReadFrom(r io.Reader) (int64, error) {
 	var nc int64
-	v, n, err := unmarshalInteger(r, 4)
+	v, n, err := unmarshalLength(r, e.varint)
 	nc += n
 	if err != nil {
 		return nc, err
 	}
-	storeLen := int(v)
-	answer := make([]byte, storeLen, storeLen)
-	for i := 0; i < storeLen; i++ {
-		v, n, err := unmarshalInteger(r, 1)
-		nc += n
-		if err != nil {
-			return nc, err
-		}
-		answer[i] = uint8(v)
+	err = checkLimit("MaxStringLength", e.max, v)
+	if err != nil {
+		return nc, err
+	}
+	answer, n, err := readBytes(r, v)
+	nc += n
+	if err != nil {
+		return nc, err
 	}
 	*e.store = string(answer)
 	return nc, nil
@@ -18,7 +18,10 @@ package raw
 
 import "io"
 
-type structEncoder struct{ store []Encoder }
+type structEncoder struct {
+	store []Encoder
+	names []string
+}
 
 func (e structEncoder) Signature() string {
 	ans := "struct {"
@@ -38,7 +41,7 @@ func (e structEncoder) WriteTo(w io.Writer) (int64, error) {
 		n, err := e.store[i].WriteTo(w)
 		count += n
 		if err != nil {
-			return count, err
+			return count, prependPath(err, "."+e.names[i])
 		}
 	}
 	return count, nil
@@ -50,7 +53,7 @@ func (e structEncoder) ReadFrom(r io.Reader) (int64, error) {
 		n, err := e.store[i].ReadFrom(r)
 		count += n
 		if err != nil {
-			return count, err
+			return count, decodeError(err, "."+e.names[i], count-n, e.store[i].Signature())
 		}
 	}
 	return count, nil
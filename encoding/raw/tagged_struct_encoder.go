@@ -0,0 +1,148 @@
+// Copyright 2016 Rafael Lorandi <coolparadox@gmail.com>
+// This file is part of Raw, a binary encoder of Go types.
+//
+// Raw is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Raw is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Raw. If not, see <http://www.gnu.org/licenses/>.
+
+package raw
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+)
+
+// taggedStructEncoder serializes structs whose fields have field IDs
+// (see Struct Tags).
+//
+// Serialized data is composed of the number of fields
+// followed by the ID, the length and the data of each field.
+type taggedStructEncoder struct {
+	store  []Encoder
+	names  []string
+	ids    []uint32
+	fields []reflect.Value
+	varint bool
+}
+
+func (e taggedStructEncoder) Signature() string {
+	ans := "struct {"
+	for i := 0; i < len(e.store); i++ {
+		if i > 0 {
+			ans += ";"
+		}
+		ans += " " + strconv.FormatUint(uint64(e.ids[i]), 10) + ":" + e.store[i].Signature()
+	}
+	ans += " }"
+	return ans
+}
+
+func (e taggedStructEncoder) WriteTo(w io.Writer) (int64, error) {
+	var nc int64
+	n, err := marshalLength(len(e.store), e.varint, w)
+	nc += n
+	if err != nil {
+		return nc, err
+	}
+	b := new(bytes.Buffer)
+	for i := 0; i < len(e.store); i++ {
+		b.Reset()
+		_, err = e.store[i].WriteTo(b)
+		if err != nil {
+			return nc, prependPath(err, "."+e.names[i])
+		}
+		n, err = marshalInteger(uint64(e.ids[i]), 4, w)
+		nc += n
+		if err != nil {
+			return nc, err
+		}
+		n, err = marshalLength(b.Len(), e.varint, w)
+		nc += n
+		if err != nil {
+			return nc, prependPath(err, "."+e.names[i])
+		}
+		n, err = b.WriteTo(w)
+		nc += n
+		if err != nil {
+			return nc, err
+		}
+	}
+	return nc, nil
+}
+
+func (e taggedStructEncoder) ReadFrom(r io.Reader) (int64, error) {
+	var nc int64
+	v, n, err := unmarshalLength(r, e.varint)
+	nc += n
+	if err != nil {
+		return nc, err
+	}
+	if v == lengthOfNil {
+		return nc, fmt.Errorf("invalid number of struct fields")
+	}
+	count := int(v)
+	found := make([]bool, len(e.store))
+	for i := 0; i < count; i++ {
+		id, n, err := unmarshalInteger(r, 4)
+		nc += n
+		if err != nil {
+			return nc, err
+		}
+		length, n, err := unmarshalLength(r, e.varint)
+		nc += n
+		if err != nil {
+			return nc, err
+		}
+		if length == lengthOfNil {
+			return nc, fmt.Errorf("struct field ID %v: invalid length", id)
+		}
+		j := e.index(uint32(id))
+		if j < 0 {
+			// Field unknown to this struct
+			n, err = io.CopyN(io.Discard, r, int64(length))
+			nc += n
+			if err != nil {
+				return nc, err
+			}
+			continue
+		}
+		n, err = e.store[j].ReadFrom(io.LimitReader(r, int64(length)))
+		nc += n
+		if err != nil {
+			return nc, decodeError(err, "."+e.names[j], nc-n, e.store[j].Signature())
+		}
+		if n != int64(length) {
+			return nc, decodeError(fmt.Errorf("struct field ID %v: expected %v bytes, consumed %v", id, length, n), "."+e.names[j], nc-n, e.store[j].Signature())
+		}
+		found[j] = true
+	}
+	for j := 0; j < len(e.store); j++ {
+		if !found[j] {
+			e.fields[j].Set(reflect.Zero(e.fields[j].Type()))
+		}
+	}
+	return nc, nil
+}
+
+// index answers the position of a field given its ID,
+// or -1 if the ID is unknown.
+func (e taggedStructEncoder) index(id uint32) int {
+	for i := 0; i < len(e.ids); i++ {
+		if e.ids[i] == id {
+			return i
+		}
+	}
+	return -1
+}
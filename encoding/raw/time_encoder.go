@@ -0,0 +1,89 @@
+// Copyright 2016 Rafael Lorandi <coolparadox@gmail.com>
+// This file is part of Raw, a binary encoder of Go types.
+//
+// Raw is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Raw is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Raw. If not, see <http://www.gnu.org/licenses/>.
+
+package raw
+
+import (
+	"io"
+	"time"
+)
+
+// timeEncoder serializes time.Time values
+// as a timeLayout (see Time and Big Numbers).
+type timeEncoder struct {
+	store  *time.Time
+	layout *timeLayout
+	worker Encoder
+}
+
+// timeLayout is the serialized form of time.Time values.
+type timeLayout struct {
+	Sec      int64
+	Nsec     uint32
+	Location string
+	Zone     string
+	Offset   int32
+}
+
+func (timeEncoder) Signature() string {
+	return "time.Time"
+}
+
+func (e timeEncoder) WriteTo(w io.Writer) (int64, error) {
+	t := e.store.Round(0)
+	e.layout.Sec = t.Unix()
+	e.layout.Nsec = uint32(t.Nanosecond())
+	e.layout.Location = t.Location().String()
+	zone, offset := t.Zone()
+	e.layout.Zone = zone
+	e.layout.Offset = int32(offset)
+	return e.worker.WriteTo(w)
+}
+
+func (e timeEncoder) ReadFrom(r io.Reader) (int64, error) {
+	n, err := e.worker.ReadFrom(r)
+	if err != nil {
+		return n, layoutError(err, e.Signature())
+	}
+	t := time.Unix(e.layout.Sec, int64(e.layout.Nsec))
+	*e.store = t.In(location(t, e.layout.Location, e.layout.Zone, int(e.layout.Offset)))
+	return n, nil
+}
+
+// location answers the location of a recovered time.Time value.
+// The location is looked up by name;
+// if it's unknown,
+// or if its offset at the given instant differs from the serialized one,
+// a fixed zone with the serialized name and offset is answered instead.
+func location(t time.Time, name string, zone string, offset int) *time.Location {
+	var loc *time.Location
+	switch name {
+	case "UTC":
+		loc = time.UTC
+	case "Local":
+		loc = time.Local
+	default:
+		var err error
+		loc, err = time.LoadLocation(name)
+		if err != nil {
+			return time.FixedZone(zone, offset)
+		}
+	}
+	if _, o := t.In(loc).Zone(); o != offset {
+		return time.FixedZone(zone, offset)
+	}
+	return loc
+}
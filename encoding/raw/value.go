@@ -0,0 +1,511 @@
+// Copyright 2016 Rafael Lorandi <coolparadox@gmail.com>
+// This file is part of Raw, a binary encoder of Go types.
+//
+// Raw is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Raw is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Raw. If not, see <http://www.gnu.org/licenses/>.
+
+package raw
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+/*
+Value is a generic representation of serialized data,
+recovered without a placeholder variable (see ReadValue).
+
+Which fields hold the contents of a Value depends on its Signature:
+
+	bool                  Bool
+	int8 ... int64, int   Int
+	uint8 ... uintptr     Uint
+	float32, float64      Float
+	complex64, complex128 Complex
+	string                String
+	array, slice          Elems
+	map                   Keys and Elems, pairwise
+	nil slice or map      Nil (see Nil Slices and Maps)
+	struct                Elems, one per field; IDs if fields have IDs
+	pointer               Elem, or nil if the pointer is nil
+	interface             String, the registered name (see Register),
+	                      and Elem, or nil if the interface is nil
+	time.Time ... big.Rat Elem, the serialized form of the value
+	raw(T), binary(T)     Bytes
+
+A struct with field IDs may hold fields of IDs unknown to its signature;
+their Values have a nil Signature and keep serialized data in Bytes.
+*/
+type Value struct {
+
+	// Signature describes the type of the Value.
+	// It's never of RecursiveKind;
+	// recursive references are resolved to the enclosing type.
+	Signature *Signature
+
+	Bool    bool
+	Int     int64
+	Uint    uint64
+	Float   float64
+	Complex complex128
+	String  string
+	Bytes   []byte
+	Elems   []Value
+	Keys    []Value
+	IDs     []uint32
+	Elem    *Value
+	Nil     bool
+}
+
+// builtinLayouts are placeholders of the serialized form
+// of types with built-in support (see Time and Big Numbers).
+var builtinLayouts = map[string]interface{}{
+	"time.Time":     new(timeLayout),
+	"time.Duration": new(int64),
+	"big.Int":       new(bigIntLayout),
+	"big.Float":     new([]byte),
+	"big.Rat":       new(bigRatLayout),
+}
+
+// builtinLayout answers the signature of the serialized form
+// of a type with built-in support.
+func builtinLayout(name string) (*Signature, error) {
+	e, err := new(builder).makeEncoder(reflect.ValueOf(builtinLayouts[name]))
+	if err != nil {
+		return nil, err
+	}
+	return ParseSignature(e.Signature())
+}
+
+// registeredSignature answers the signature of a registered type
+// (see Register).
+func registeredSignature(name string) (*Signature, error) {
+	t, ok := registeredType(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: '%s'", UnregisteredTypeError, name)
+	}
+	e, err := new(builder).makeEncoder(reflect.New(t))
+	if err != nil {
+		return nil, err
+	}
+	return ParseSignature(e.Signature())
+}
+
+/*
+ReadValue recovers serialized data of a given type signature
+into a Value,
+without the need of a placeholder variable of the original type.
+
+Data must be in the format of Encoders created by New,
+without a type header.
+Interface values can be recovered only if their concrete types
+are registered (see Register).
+
+The Value can be serialized back to identical data by WriteTo.
+*/
+func ReadValue(signature string, r io.Reader) (*Value, error) {
+	s, err := ParseSignature(signature)
+	if err != nil {
+		return nil, err
+	}
+	v, n, err := readValue(r, s, nil)
+	if err != nil {
+		if n == 0 && errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		return nil, truncated(decodeError(err, "", 0, s.String()), n)
+	}
+	return &v, nil
+}
+
+// readValue recovers a Value of a given signature,
+// whose enclosing types are in stack.
+// Returns the Value and the number of bytes read.
+func readValue(r io.Reader, s *Signature, stack []*Signature) (Value, int64, error) {
+	s, stack = resolve(s, stack)
+	v := Value{Signature: s}
+	var nc int64
+	switch s.Kind {
+	case BasicKind:
+		return readBasicValue(r, v)
+	case BuiltinKind:
+		layout, err := builtinLayout(s.Name)
+		if err != nil {
+			return v, nc, err
+		}
+		elem, n, err := readValue(r, layout, nil)
+		v.Elem = &elem
+		return v, n, layoutError(err, s.String())
+	case MarshalerKind, BinaryMarshalerKind:
+		length, n, err := unmarshalInteger(r, 4)
+		nc += n
+		if err != nil {
+			return v, nc, err
+		}
+		v.Bytes, n, err = readBytes(r, length)
+		nc += n
+		return v, nc, err
+	}
+	stack = append(stack[:len(stack):len(stack)], s)
+	switch s.Kind {
+	case InterfaceKind:
+		n, err := stringEncoder{store: &v.String}.ReadFrom(r)
+		nc += n
+		if err != nil || v.String == "" {
+			return v, nc, err
+		}
+		concrete, err := registeredSignature(v.String)
+		if err != nil {
+			return v, nc, err
+		}
+		elem, n, err := readValue(r, concrete, nil)
+		nc += n
+		v.Elem = &elem
+		if err != nil {
+			return v, nc, decodeError(err, "", nc-n, concrete.String())
+		}
+		return v, nc, nil
+	case PointerKind:
+		marker, n, err := unmarshalInteger(r, 1)
+		nc += n
+		if err != nil {
+			return v, nc, err
+		}
+		switch marker {
+		case ptrNil:
+			return v, nc, nil
+		case ptrValue:
+		default:
+			return v, nc, fmt.Errorf("invalid pointer marker %#x", marker)
+		}
+		elem, n, err := readValue(r, s.Elem, stack)
+		nc += n
+		v.Elem = &elem
+		if err != nil {
+			return v, nc, decodeError(err, "", nc-n, s.Elem.String())
+		}
+		return v, nc, nil
+	case ArrayKind:
+		v.Elems = make([]Value, 0, preallocLen(uint64(s.Len), reflect.TypeOf(v).Size()))
+		for i := 0; i < s.Len; i++ {
+			elem, n, err := readValue(r, s.Elem, stack)
+			nc += n
+			if err != nil {
+				return v, nc, decodeError(err, "["+strconv.Itoa(i)+"]", nc-n, s.Elem.String())
+			}
+			v.Elems = append(v.Elems, elem)
+		}
+		return v, nc, nil
+	case SliceKind, MapKind:
+		length, n, err := unmarshalInteger(r, 4)
+		nc += n
+		if err != nil {
+			return v, nc, err
+		}
+		if length == nilLength {
+			v.Nil = true
+			return v, nc, nil
+		}
+		v.Elems = make([]Value, 0, preallocLen(length, reflect.TypeOf(v).Size()))
+		if s.Kind == MapKind {
+			v.Keys = make([]Value, 0, cap(v.Elems))
+		}
+		for i := uint64(0); i < length; i++ {
+			if s.Kind == MapKind {
+				key, n, err := readValue(r, s.Key, stack)
+				nc += n
+				if err != nil {
+					return v, nc, decodeError(err, "", nc-n, s.Key.String())
+				}
+				v.Keys = append(v.Keys, key)
+			}
+			elem, n, err := readValue(r, s.Elem, stack)
+			nc += n
+			if err != nil {
+				return v, nc, decodeError(err, "["+strconv.FormatUint(i, 10)+"]", nc-n, s.Elem.String())
+			}
+			v.Elems = append(v.Elems, elem)
+		}
+		return v, nc, nil
+	case StructKind:
+		if !s.Tagged {
+			v.Elems = make([]Value, 0, len(s.Fields))
+			for i, f := range s.Fields {
+				elem, n, err := readValue(r, f.Type, stack)
+				nc += n
+				if err != nil {
+					return v, nc, decodeError(err, "."+strconv.Itoa(i), nc-n, f.Type.String())
+				}
+				v.Elems = append(v.Elems, elem)
+			}
+			return v, nc, nil
+		}
+		count, n, err := unmarshalInteger(r, 4)
+		nc += n
+		if err != nil {
+			return v, nc, err
+		}
+		for i := uint64(0); i < count; i++ {
+			id, n, err := unmarshalInteger(r, 4)
+			nc += n
+			if err != nil {
+				return v, nc, err
+			}
+			length, n, err := unmarshalInteger(r, 4)
+			nc += n
+			if err != nil {
+				return v, nc, err
+			}
+			var elem Value
+			var ft *Signature
+			for _, f := range s.Fields {
+				if f.ID == uint32(id) {
+					ft = f.Type
+				}
+			}
+			if ft == nil {
+				// Field unknown to the signature
+				elem.Bytes, n, err = readBytes(r, length)
+			} else {
+				elem, n, err = readValue(io.LimitReader(r, int64(length)), ft, stack)
+				if err == nil && n != int64(length) {
+					err = fmt.Errorf("struct field ID %v: expected %v bytes, consumed %v", id, length, n)
+				}
+			}
+			nc += n
+			if err != nil {
+				sig := "?"
+				if ft != nil {
+					sig = ft.String()
+				}
+				return v, nc, decodeError(err, "."+strconv.FormatUint(id, 10), nc-n, sig)
+			}
+			v.Elems = append(v.Elems, elem)
+			v.IDs = append(v.IDs, uint32(id))
+		}
+		return v, nc, nil
+	}
+	return v, nc, fmt.Errorf("unknown signature kind %v", s.Kind)
+}
+
+// readBasicValue recovers a Value of a basic kind.
+// Returns the Value and the number of bytes read.
+func readBasicValue(r io.Reader, v Value) (Value, int64, error) {
+	switch v.Signature.Name {
+	case "string":
+		n, err := stringEncoder{store: &v.String}.ReadFrom(r)
+		return v, n, err
+	case "complex64", "complex128":
+		width := basicWidth(v.Signature.Name) / 2
+		re, n, err := unmarshalInteger(r, width)
+		if err != nil {
+			return v, n, err
+		}
+		im, m, err := unmarshalInteger(r, width)
+		v.Complex = complex(floatFromBits(re, width), floatFromBits(im, width))
+		return v, n + m, err
+	}
+	width := basicWidth(v.Signature.Name)
+	x, n, err := unmarshalInteger(r, width)
+	if err != nil {
+		return v, n, err
+	}
+	switch v.Signature.Name {
+	case "bool":
+		v.Bool = x != 0
+	case "float32", "float64":
+		v.Float = floatFromBits(x, width)
+	case "int", "int8", "int16", "int32", "int64":
+		// Signed integers are serialized shifted to be positive.
+		v.Int = int64(x^1<<(8*width-1)) << (64 - 8*width) >> (64 - 8*width)
+	default:
+		v.Uint = x
+	}
+	return v, n, nil
+}
+
+// basicWidth answers the number of bytes of serialized data
+// of basic kinds other than string.
+func basicWidth(name string) int {
+	switch name {
+	case "bool", "int8", "uint8":
+		return 1
+	case "int16", "uint16":
+		return 2
+	case "int32", "uint32", "float32":
+		return 4
+	case "complex128":
+		return 16
+	}
+	return 8
+}
+
+// floatFromBits converts serialized data to a floating point number.
+func floatFromBits(x uint64, width int) float64 {
+	if width == 4 {
+		return float64(math.Float32frombits(uint32(x)))
+	}
+	return math.Float64frombits(x)
+}
+
+// floatToBits converts a floating point number to serialized data.
+func floatToBits(f float64, width int) uint64 {
+	if width == 4 {
+		return uint64(math.Float32bits(float32(f)))
+	}
+	return math.Float64bits(f)
+}
+
+// WriteTo serializes v in the format of Encoders created by New.
+func (v *Value) WriteTo(w io.Writer) (int64, error) {
+	b := new(bytes.Buffer)
+	err := v.write(b)
+	if err != nil {
+		return 0, err
+	}
+	return b.WriteTo(w)
+}
+
+// write serializes v to a buffer.
+func (v *Value) write(b *bytes.Buffer) error {
+	s := v.Signature
+	if s == nil {
+		// Field of unknown ID
+		b.Write(v.Bytes)
+		return nil
+	}
+	switch s.Kind {
+	case BasicKind:
+		width := basicWidth(s.Name)
+		switch s.Name {
+		case "string":
+			_, err := stringEncoder{store: &v.String}.WriteTo(b)
+			if err != nil {
+				return err
+			}
+		case "bool":
+			var x uint64
+			if v.Bool {
+				x = 0xFF
+			}
+			marshalInteger(x, 1, b)
+		case "float32", "float64":
+			marshalInteger(floatToBits(v.Float, width), width, b)
+		case "complex64", "complex128":
+			marshalInteger(floatToBits(real(v.Complex), width/2), width/2, b)
+			marshalInteger(floatToBits(imag(v.Complex), width/2), width/2, b)
+		case "int", "int8", "int16", "int32", "int64":
+			marshalInteger(uint64(v.Int)^1<<(8*width-1), width, b)
+		default:
+			marshalInteger(v.Uint, width, b)
+		}
+	case BuiltinKind, PointerKind:
+		if v.Elem == nil {
+			if s.Kind == BuiltinKind {
+				return fmt.Errorf("missing serialized form of %s", s.Name)
+			}
+			marshalInteger(ptrNil, 1, b)
+			return nil
+		}
+		if s.Kind == PointerKind {
+			marshalInteger(ptrValue, 1, b)
+		}
+		return v.Elem.write(b)
+	case MarshalerKind, BinaryMarshalerKind:
+		_, err := marshalLength(len(v.Bytes), false, b)
+		if err != nil {
+			return err
+		}
+		b.Write(v.Bytes)
+	case InterfaceKind:
+		stringEncoder{store: &v.String}.WriteTo(b)
+		if v.String == "" {
+			return nil
+		}
+		if v.Elem == nil {
+			return fmt.Errorf("missing concrete value of '%s'", v.String)
+		}
+		return v.Elem.write(b)
+	case ArrayKind, SliceKind, MapKind:
+		if s.Kind == ArrayKind && len(v.Elems) != s.Len {
+			return fmt.Errorf("array of %v elements holds %v", s.Len, len(v.Elems))
+		}
+		if s.Kind == MapKind && len(v.Keys) != len(v.Elems) {
+			return fmt.Errorf("map of %v keys holds %v elements", len(v.Keys), len(v.Elems))
+		}
+		if s.Kind != ArrayKind && v.Nil {
+			marshalInteger(nilLength, 4, b)
+			return nil
+		}
+		if s.Kind != ArrayKind {
+			_, err := marshalLength(len(v.Elems), false, b)
+			if err != nil {
+				return err
+			}
+		}
+		for i := range v.Elems {
+			if s.Kind == MapKind {
+				err := v.Keys[i].write(b)
+				if err != nil {
+					return err
+				}
+			}
+			err := v.Elems[i].write(b)
+			if err != nil {
+				return prependPath(err, "["+strconv.Itoa(i)+"]")
+			}
+		}
+	case StructKind:
+		if !s.Tagged {
+			if len(v.Elems) != len(s.Fields) {
+				return fmt.Errorf("struct of %v fields holds %v", len(s.Fields), len(v.Elems))
+			}
+			for i := range v.Elems {
+				err := v.Elems[i].write(b)
+				if err != nil {
+					return prependPath(err, "."+strconv.Itoa(i))
+				}
+			}
+			return nil
+		}
+		if len(v.IDs) != len(v.Elems) {
+			return fmt.Errorf("struct of %v field IDs holds %v fields", len(v.IDs), len(v.Elems))
+		}
+		_, err := marshalLength(len(v.Elems), false, b)
+		if err != nil {
+			return err
+		}
+		field := new(bytes.Buffer)
+		for i := range v.Elems {
+			field.Reset()
+			err := v.Elems[i].write(field)
+			if err != nil {
+				return prependPath(err, "."+strconv.FormatUint(uint64(v.IDs[i]), 10))
+			}
+			marshalInteger(uint64(v.IDs[i]), 4, b)
+			_, err = marshalLength(field.Len(), false, b)
+			if err != nil {
+				return prependPath(err, "."+strconv.FormatUint(uint64(v.IDs[i]), 10))
+			}
+			field.WriteTo(b)
+		}
+	default:
+		return fmt.Errorf("unknown signature kind %v", s.Kind)
+	}
+	return nil
+}
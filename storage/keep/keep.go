@@ -45,8 +45,9 @@ Suported Types
 
 Types of the following kinds are supported by Keep:
 bool,
-int8, int16, int32, int64,
-uint8, uint16, uint32, uint64,
+int, int8, int16, int32, int64,
+uint, uint8, uint16, uint32, uint64,
+uintptr,
 float32, float64,
 complex64, complex128,
 string,
@@ -54,14 +55,18 @@ array of any supported type,
 map of any supported type,
 pointer to any supported type,
 slice of any supported type,
-struct with fields of any supported type.
+struct with fields of any supported type,
+interface holding a value of a type registered in package raw
+(see raw.Register),
+time.Time, time.Duration, big.Int, big.Float, big.Rat,
+any type that serializes itself
+(see raw.Marshaler and encoding.BinaryMarshaler).
 
 Unsupported Types
 
 Types of the following kinds are not supported:
-int, uint, uintptr (their size is platform dependent);
 unsafe pointer (not meaningful across systems);
-chan, func, interface (language plumbing).
+chan, func (language plumbing).
 
 Issues
 
@@ -70,7 +75,8 @@ is the access point to typed data for a given collection.
 The Keep handler for the collection
 is eternally bound to its placeholder variable.
 
-Structs must have all fields exported.
+Structs must have all fields exported,
+unless fields are left out (see Struct Tags in package raw).
 
 Recovery of array, map, ptr or slice always creates new values
 (there is no reuse of allocated resources).
@@ -134,6 +140,7 @@ import (
 	"github.com/coolparadox/go/encoding/raw"
 	"github.com/coolparadox/go/storage/lazydb"
 	"io"
+	"strings"
 )
 
 // keepLabel is used by verifying if a database contains a Keep collection.
@@ -147,8 +154,14 @@ const (
 
 // Keep is a handler to a collection of typed Go data stored in the filesystem.
 type Keep struct {
-	encoder raw.Encoder
-	db      lazydb.LazyDB
+	encoder     raw.Encoder
+	db          lazydb.LazyDB
+	placeholder interface{}
+	options     raw.Options
+
+	// projected tells if the handler recovers only some fields
+	// of the placeholder variable (see Project).
+	projected bool
 }
 
 // New creates a new Keep collection,
@@ -162,10 +175,31 @@ type Keep struct {
 // for storing the collection.
 // If it's the first time this directory is used by package keep,
 // it must be empty.
+// Otherwise, the type of the placeholder variable must be compatible
+// with every type the collection has been opened with (see raw.Compatible),
+// and it's recorded for checking later openings.
 //
 // Returns a Keep handler.
 func New(placeholder interface{}, dir string) (Keep, error) {
-	encoder, err := raw.New(placeholder)
+	return NewWithOptions(placeholder, dir, raw.Options{})
+}
+
+// NewWithOptions is like New,
+// but the placeholder variable is encoded according to options of package raw
+// (see raw.NewWithOptions).
+//
+// For instance, option PreserveNil keeps nil slices and maps
+// distinct from empty ones across storage;
+// items saved without it are still loaded, as empty.
+//
+// Options affecting the serialization format are recorded
+// in the collection (see raw.FormatFlags),
+// and an existent collection must be opened with the same ones,
+// otherwise an error is returned.
+// Collections created by previous versions of package keep
+// are assumed to have been created with zero options.
+func NewWithOptions(placeholder interface{}, dir string, o raw.Options) (Keep, error) {
+	encoder, err := raw.NewWithOptions(placeholder, o)
 	if err != nil {
 		return Keep{}, fmt.Errorf("failed to initialize encoder: %s", err)
 	}
@@ -179,6 +213,7 @@ func New(placeholder interface{}, dir string) (Keep, error) {
 		_, err = db.SaveAs(0, []io.Reader{
 			bytes.NewReader([]byte(keepLabel)),
 			bytes.NewReader([]byte(encoder.Signature())),
+			bytes.NewReader(format(o)),
 		})
 		if err != nil {
 			return Keep{}, fmt.Errorf("failed to initialize database: %s", err)
@@ -209,15 +244,96 @@ func New(placeholder interface{}, dir string) (Keep, error) {
 	if string(dbKeepLabel.Bytes()) != keepLabel {
 		return Keep{}, fmt.Errorf("not a Keep database")
 	}
-	if string(dbSignature.Bytes()) != encoder.Signature() {
-		return Keep{}, fmt.Errorf("type signature mismatch: expected '%s', found in database '%s'", encoder.Signature(), string(dbSignature.Bytes()))
+	// The collection records the signatures of all types
+	// it has been opened with, one per line,
+	// since items may have been saved with any of them.
+	signatures := strings.Split(dbSignature.String(), "\n")
+	known := false
+	for _, signature := range signatures {
+		err = raw.Compatible(signature, encoder.Signature())
+		if err != nil {
+			return Keep{}, fmt.Errorf("type signature '%s' found in database is not compatible with '%s': %s", signature, encoder.Signature(), err)
+		}
+		if signature == encoder.Signature() {
+			known = true
+		}
+	}
+	// Collections created before the format was recorded
+	// use zero options.
+	dbFormat := bytes.NewBuffer(format(raw.Options{}))
+	ok, err = db.Exists(0, 2)
+	if err != nil {
+		return Keep{}, fmt.Errorf("failed to query database: %s", err)
+	}
+	if ok {
+		dbFormat.Reset()
+		_, err = db.Load(0, []io.Writer{nil, nil, dbFormat})
+		if err != nil {
+			return Keep{}, fmt.Errorf("failed to query database: %s", err)
+		}
+	}
+	err = compatibleFormat(dbFormat.Bytes(), format(o))
+	if err != nil {
+		return Keep{}, fmt.Errorf("options are not compatible with the database: %s", err)
+	}
+	if !known {
+		signatures = append(signatures, encoder.Signature())
+		_, err = db.SaveAs(0, []io.Reader{nil, strings.NewReader(strings.Join(signatures, "\n"))})
+		if err != nil {
+			return Keep{}, fmt.Errorf("failed to update database: %s", err)
+		}
 	}
 	return Keep{
-		encoder: encoder,
-		db:      db,
+		encoder:     encoder,
+		db:          db,
+		placeholder: placeholder,
+		options:     o,
 	}, nil
 }
 
+// format answers the serialization format of items
+// selected by options:
+// the format flags of package raw (see raw.FormatFlags),
+// followed by one if items are self-describing or zero otherwise.
+func format(o raw.Options) []byte {
+	var selfDescribing byte
+	if o.SelfDescribing {
+		selfDescribing = 1
+	}
+	return []byte{raw.FormatFlags(o), selfDescribing}
+}
+
+// compatibleFormat verifies if items stored in a format
+// can be loaded in another one (see format).
+func compatibleFormat(stored, loading []byte) error {
+	if len(stored) != 2 {
+		return fmt.Errorf("invalid format of length %v", len(stored))
+	}
+	if stored[1] != loading[1] {
+		return fmt.Errorf("self-describing mismatch: expected %v, found %v", loading[1] == 1, stored[1] == 1)
+	}
+	return raw.CompatibleFlags(stored[0], loading[0])
+}
+
+// Project answers a handler to the same collection
+// whose Load restores only given field paths
+// of a struct placeholder variable,
+// leaving other fields with their zero values
+// (see raw.NewProjection).
+// Loading is faster for collections created with option LengthPrefixed
+// of package raw.
+//
+// The answered handler cannot save data.
+func (k Keep) Project(paths ...string) (Keep, error) {
+	encoder, err := raw.NewProjection(k.placeholder, k.options, paths...)
+	if err != nil {
+		return Keep{}, fmt.Errorf("failed to initialize encoder: %s", err)
+	}
+	k.encoder = encoder
+	k.projected = true
+	return k, nil
+}
+
 // Signature answers the type signature of the placeholder variable (see New).
 func (k Keep) Signature() string {
 	return k.encoder.Signature()
@@ -230,6 +346,9 @@ func (k Keep) SaveAs(pos uint32) error {
 	if pos == 0 {
 		return fmt.Errorf("position must be greater than zero")
 	}
+	if k.projected {
+		return fmt.Errorf("cannot save through a projection")
+	}
 	_, err := k.db.SaveAs(pos, []io.Reader{k.encoder})
 	if err != nil {
 		return fmt.Errorf("cannot save position %v: %s", pos, err)
@@ -240,6 +359,7 @@ func (k Keep) SaveAs(pos uint32) error {
 // Load restores the contents of the placeholder variable (see New)
 // with data from a given position in the collection.
 // Position must have been previously filled by Save or SaveAs.
+// Corrupt data is reported by an error wrapping *raw.DecodeError.
 func (k Keep) Load(pos uint32) error {
 	if pos == 0 {
 		return fmt.Errorf("position must be greater than zero")
@@ -253,7 +373,7 @@ func (k Keep) Load(pos uint32) error {
 	}
 	_, err = k.db.Load(pos, []io.Writer{k.encoder})
 	if err != nil {
-		return fmt.Errorf("cannot load position %v: %s", pos, err)
+		return fmt.Errorf("cannot load position %v: %w", pos, err)
 	}
 	return nil
 }
@@ -277,6 +397,9 @@ func (k Keep) Exists(pos uint32) (bool, error) {
 //
 // Returns the assigned position.
 func (k Keep) Save() (uint32, error) {
+	if k.projected {
+		return 0, fmt.Errorf("cannot save through a projection")
+	}
 	pos, _, err := k.db.Save([]io.Reader{k.encoder})
 	if err != nil {
 		return 0, fmt.Errorf("cannot save: %s", err)
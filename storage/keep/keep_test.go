@@ -20,6 +20,7 @@ package keep_test
 import (
 	"flag"
 	"fmt"
+	"github.com/coolparadox/go/encoding/raw"
 	"github.com/coolparadox/go/storage/keep"
 	"os"
 	"testing"
@@ -87,6 +88,83 @@ func TestNewOtherSignature(t *testing.T) {
 	}
 }
 
+func TestNewCompatibleSignature(t *testing.T) {
+	var otherData struct {
+		X int
+	}
+	_, err := keep.New(&otherData, myPath)
+	if err != nil {
+		t.Fatalf("keep.New failed in opening database with compatible type signature: %s", err)
+	}
+}
+
+func TestSignatureHistory(t *testing.T) {
+	dir, err := os.MkdirTemp("", "keep")
+	if err != nil {
+		t.Fatalf("cannot create directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	var v1 struct {
+		A int32 `raw:"1"`
+	}
+	_, err = keep.New(&v1, dir)
+	if err != nil {
+		t.Fatalf("keep.New failed: %s", err)
+	}
+	var v2 struct {
+		A int32  `raw:"1"`
+		B string `raw:"2"`
+	}
+	k, err := keep.New(&v2, dir)
+	if err != nil {
+		t.Fatalf("keep.New failed in opening database with added field: %s", err)
+	}
+	v2.B = "abcd"
+	err = k.SaveAs(1)
+	if err != nil {
+		t.Fatalf("keep.SaveAs failed: %s", err)
+	}
+	// Field B was saved with another type.
+	var v3 struct {
+		A int32 `raw:"1"`
+		B int64 `raw:"2"`
+	}
+	_, err = keep.New(&v3, dir)
+	if err == nil {
+		t.Fatalf("keep.New suceeded in opening database with a field whose type changed")
+	}
+	_, err = keep.New(&v1, dir)
+	if err != nil {
+		t.Fatalf("keep.New failed in reopening database with its first type: %s", err)
+	}
+}
+
+func TestNewOtherOptions(t *testing.T) {
+	for _, o := range []raw.Options{{VarintLengths: true}, {LengthPrefixed: true}, {SelfDescribing: true}} {
+		_, err := keep.NewWithOptions(&myData.MyType, myPath, o)
+		if err == nil {
+			t.Fatalf("keep.NewWithOptions suceeded in opening database with options %+v", o)
+		}
+	}
+	_, err := keep.NewWithOptions(&myData.MyType, myPath, raw.Options{PreserveNil: true})
+	if err != nil {
+		t.Fatalf("keep.NewWithOptions failed in opening database with compatible options: %s", err)
+	}
+	dir, err := os.MkdirTemp("", "keep")
+	if err != nil {
+		t.Fatalf("cannot create directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	_, err = keep.NewWithOptions(&myData.MyType, dir, raw.Options{VarintLengths: true})
+	if err != nil {
+		t.Fatalf("keep.NewWithOptions failed: %s", err)
+	}
+	_, err = keep.New(&myData.MyType, dir)
+	if err == nil {
+		t.Fatalf("keep.New suceeded in opening database created with other options")
+	}
+}
+
 func TestSaveAs(t *testing.T) {
 	var err error
 	myData.X = 8765
@@ -108,6 +186,29 @@ func TestLoad(t *testing.T) {
 	}
 }
 
+func TestProject(t *testing.T) {
+	p, err := myData.Project("X")
+	if err != nil {
+		t.Fatalf("keep.Project failed: %s", err)
+	}
+	myData.X = 0
+	err = p.Load(1)
+	if err != nil {
+		t.Fatalf("keep.Load of projection failed: %s", err)
+	}
+	if myData.X != 8765 {
+		t.Fatalf("Load mismatch of projection: expected 8765, received %v", myData.X)
+	}
+	err = p.SaveAs(1)
+	if err == nil {
+		t.Fatalf("keep.SaveAs of projection succeeded")
+	}
+	_, err = myData.Project("Y")
+	if err == nil {
+		t.Fatalf("keep.Project accepted an unknown field")
+	}
+}
+
 func TestExistsFalse(t *testing.T) {
 	var err error
 	ok, err := myData.Exists(2)